@@ -18,9 +18,12 @@ package api
 
 import (
 	"context"
+	"errors"
 	"os"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +31,7 @@ import (
 
 	gin_mw "github.com/SENERGY-Platform/gin-middleware"
 	"github.com/SENERGY-Platform/go-service-base/struct-logger/attributes"
+	"github.com/SENERGY-Platform/service-commons/pkg/jwt"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
@@ -61,6 +65,7 @@ func Start(ctx context.Context, wg *sync.WaitGroup, config config.Config, contro
 func Router(config config.Config, control controller.Controller) http.Handler {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	router.UseRawPath = true // template names of subdirectories contain escaped slashes, e.g. /templates/aggregates%2Fhourly
 	router.Use(
 		gin_mw.StructLoggerHandlerWithDefaultGenerators(
 			log.Logger.With(attributes.LogRecordTypeKey, attributes.HttpAccessLogRecordTypeVal),
@@ -71,6 +76,7 @@ func Router(config config.Config, control controller.Controller) http.Handler {
 		requestid.New(requestid.WithCustomHeaderStrKey("X-Request-ID")),
 		gin_mw.ErrorHandler(model.GetStatusCode, ", "),
 		gin_mw.StructRecoveryHandler(log.Logger, gin_mw.DefaultRecoveryFunc),
+		tokenParser(config),
 	)
 	for _, e := range endpoints {
 		log.Logger.Info("add endpoint", "name", runtime.FuncForPC(reflect.ValueOf(e).Pointer()).Name())
@@ -79,10 +85,103 @@ func Router(config config.Config, control controller.Controller) http.Handler {
 	return router
 }
 
-func getToken(request *http.Request) string {
-	return request.Header.Get("Authorization")
+// tokenParser parses the JWT of each request and stores it in the request context. The signature is validated
+// with the certificates of keycloak, unless InsecureSkipTokenValidation is configured.
+// Requests without an Authorization header are passed on unchanged, endpoints requiring a token reject them in getToken.
+func tokenParser(config config.Config) gin.HandlerFunc {
+	var certProvider *jwt.KeycloakCertProvider
+	if !config.InsecureSkipTokenValidation {
+		certProvider = &jwt.KeycloakCertProvider{CertUrl: config.KeycloakUrl + "/realms/master/protocol/openid-connect/certs"}
+	} else {
+		log.Logger.Warn("signatures of auth tokens are not validated")
+	}
+	return func(c *gin.Context) {
+		auth := jwt.GetAuthToken(c.Request)
+		if len(auth) == 0 {
+			return
+		}
+		var token jwt.Token
+		var err error
+		if certProvider != nil {
+			token, err = jwt.ParseWithValidation(certProvider, auth)
+		} else {
+			token, err = jwt.Parse(auth)
+		}
+		if err != nil {
+			// gin_mw.ErrorHandler ignores aborted requests, so the response has to be written here
+			c.String(http.StatusUnauthorized, errors.Join(model.ErrUnauthorized, err).Error())
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(jwt.AddTokenToContext(c.Request.Context(), token))
+	}
+}
+
+func getLimitOffset(c *gin.Context) (limit int, offset int, err error) {
+	limit = 50
+	limitStr := c.Query("limit")
+	if len(limitStr) > 0 {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	offsetStr := c.Query("offset")
+	if len(offsetStr) > 0 {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return limit, offset, nil
+}
+
+func getToken(c *gin.Context) (token jwt.Token, err error) {
+	token, ok := jwt.GetTokenFromContext(c.Request.Context())
+	if !ok {
+		return token, errors.Join(model.ErrUnauthorized, jwt.ErrMissingAuthToken)
+	}
+	return token, nil
+}
+
+// setETag sets the ETag header to the version of a rule.
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", "\""+strconv.FormatInt(version, 10)+"\"")
+}
+
+// getIfMatch parses the If-Match header as rule version, see setETag.
+// ok is false if the header is missing or matches any version.
+func getIfMatch(c *gin.Context) (version int64, ok bool, err error) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if len(ifMatch) == 0 || ifMatch == "*" {
+		return 0, false, nil
+	}
+	ifMatch = strings.Trim(strings.TrimPrefix(ifMatch, "W/"), "\"")
+	version, err = strconv.ParseInt(ifMatch, 10, 64)
+	if err != nil {
+		return 0, false, errors.New("invalid If-Match header")
+	}
+	return version, true, nil
 }
 
-func getUserId(request *http.Request) string {
-	return request.Header.Get("X-UserId")
+// updateRule updates the rule and honours the If-Match header of the request.
+// A version mismatch is reported as ErrPreconditionFailed if the version was set by If-Match and as ErrConflict otherwise.
+func updateRule(c *gin.Context, control controller.Controller, rule *model.Rule) (respRule *model.TypedRule, err error) {
+	version, ok, err := getIfMatch(c)
+	if err != nil {
+		return nil, errors.Join(model.ErrBadRequest, err)
+	}
+	if ok {
+		rule.Version = version
+	} else if strings.TrimSpace(c.GetHeader("If-Match")) == "*" {
+		rule.Version = 0
+	}
+	respRule, code, err := control.UpdateRule(rule, requestid.Get(c))
+	if err != nil {
+		if ok && code == http.StatusConflict {
+			code = http.StatusPreconditionFailed
+		}
+		return nil, errors.Join(model.GetError(code), err)
+	}
+	return respRule, nil
 }
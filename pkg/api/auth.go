@@ -0,0 +1,80 @@
+/*
+ *    Copyright 2026 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+
+	"github.com/SENERGY-Platform/service-commons/pkg/jwt"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+// requireToken returns the token of the caller. If the request is not authenticated,
+// the error is attached to the gin context and ok is false.
+func requireToken(c *gin.Context) (token jwt.Token, ok bool) {
+	token, err := getToken(c)
+	if err != nil {
+		_ = c.Error(err)
+		return token, false
+	}
+	return token, true
+}
+
+// requireAdmin returns the token of the caller if the caller has the admin realm role.
+// Otherwise, the error is attached to the gin context and ok is false.
+func requireAdmin(c *gin.Context) (token jwt.Token, ok bool) {
+	token, ok = requireToken(c)
+	if !ok {
+		return token, false
+	}
+	if !token.IsAdmin() {
+		_ = c.Error(errors.Join(model.ErrForbidden, errors.New("only admins may access this resource")))
+		return token, false
+	}
+	return token, true
+}
+
+// isOwnedBy checks if users and roles select exactly the user of the token and nobody else.
+func isOwnedBy(users []string, roles []string, token jwt.Token) bool {
+	return len(users) == 1 && users[0] == token.GetUserId() && len(roles) == 0
+}
+
+// isOwnTemplateRule checks if rule is a template rule that only applies to the user of the token.
+func isOwnTemplateRule(rule *model.TypedRule, token jwt.Token) bool {
+	return rule.Type == model.RuleTypeTemplate && isOwnedBy(rule.Users, rule.Roles, token)
+}
+
+// requireRuleAccess ensures that the caller is an admin or the owner of the template rule with the given id.
+// Otherwise, the error is attached to the gin context and ok is false.
+func requireRuleAccess(c *gin.Context, control controller.Controller, id string) (token jwt.Token, ok bool) {
+	token, ok = requireToken(c)
+	if !ok || token.IsAdmin() {
+		return token, ok
+	}
+	rule, code, err := control.GetRule(id)
+	if err != nil {
+		_ = c.Error(errors.Join(model.GetError(code), err))
+		return token, false
+	}
+	if !isOwnTemplateRule(rule, token) {
+		_ = c.Error(errors.Join(model.ErrForbidden, errors.New("only admins may access rules of other users or custom rules")))
+		return token, false
+	}
+	return token, true
+}
@@ -0,0 +1,54 @@
+/*
+ *    Copyright 2026 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func init() {
+	endpoints = append(endpoints, DriftEndpoint)
+}
+
+func DriftEndpoint(router gin.IRoutes, _ config.Config, control controller.Controller) {
+	router.GET("/drift", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		report, code, err := control.GetDriftReport()
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(report)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
@@ -0,0 +1,84 @@
+/*
+ *    Copyright 2026 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	endpoints = append(endpoints, JobsEndpoint)
+}
+
+func JobsEndpoint(router gin.IRoutes, _ config.Config, control controller.Controller) {
+	router.GET("/jobs", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		limit, offset, err := getLimitOffset(c)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrBadRequest, err))
+			return
+		}
+		jobs, code, err := control.ListJobs(limit, offset)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(jobs)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/jobs/:id", func(c *gin.Context) {
+		token, ok := requireToken(c)
+		if !ok {
+			return
+		}
+		job, code, err := control.GetJob(c.Param("id"))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		if !token.IsAdmin() {
+			if len(job.RuleId) == 0 {
+				_ = c.Error(errors.Join(model.ErrForbidden, errors.New("only admins may access this job")))
+				return
+			}
+			_, ok = requireRuleAccess(c, control, job.RuleId)
+			if !ok {
+				return
+			}
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(job)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+}
@@ -19,13 +19,18 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
+	"sigs.k8s.io/yaml"
 )
 
 func init() {
@@ -34,38 +39,87 @@ func init() {
 
 func RulesEndpoint(router gin.IRoutes, _ config.Config, control controller.Controller) {
 	router.GET("/rules", func(c *gin.Context) {
-		limitStr := c.Query("limit")
-		var limit int
-		var err error
-		if len(limitStr) > 0 {
-			limit, err = strconv.Atoi(limitStr)
-			if err != nil {
-				c.Error(errors.Join(model.ErrBadRequest, err))
-				return
-			}
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		options, err := getRuleListOptions(c)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrBadRequest, err))
+			return
+		}
+
+		rules, total, code, err := control.ListRules(options)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(rules)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/rules/export", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		asYaml := c.Query("format") == "yaml" || (len(c.Query("format")) == 0 && strings.Contains(c.GetHeader("Accept"), "yaml"))
+		if asYaml {
+			c.Header("Content-Type", "application/yaml")
 		} else {
-			limit = 50
+			c.Header("Content-Type", "application/json")
+		}
+		// the bundle is streamed, errors after the first rule end the response early
+		code, err := control.ExportRules(model.NewRuleBundleWriter(c.Writer, asYaml, time.Now()))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
 		}
+	})
 
-		offsetStr := c.Query("offset")
-		var offset int
-		if len(offsetStr) > 0 {
-			offset, err = strconv.Atoi(offsetStr)
+	router.POST("/rules/import", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		options := model.RuleImportOptions{Mode: c.DefaultQuery("mode", model.RuleImportModeCreateOnly)}
+		dryRun, err := getOptionalBool(c, "dry_run")
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrBadRequest, err))
+			return
+		}
+		options.DryRun = dryRun != nil && *dryRun
+		bundle := model.RuleBundle{}
+		if strings.Contains(c.ContentType(), "yaml") {
+			b, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				_ = c.Error(errors.Join(model.ErrBadRequest, err))
+				return
+			}
+			err = yaml.Unmarshal(b, &bundle)
 			if err != nil {
-				c.Error(errors.Join(model.ErrBadRequest, err))
+				_ = c.Error(errors.Join(model.ErrBadRequest, err))
 				return
 			}
 		} else {
-			offset = 0
+			err = c.ShouldBindJSON(&bundle)
+			if err != nil {
+				_ = c.Error(errors.Join(model.ErrBadRequest, err))
+				return
+			}
 		}
-
-		rules, code, err := control.ListRules(limit, offset)
+		report, code, err := control.ImportRules(bundle, options, requestid.Get(c))
 		if err != nil {
 			_ = c.Error(errors.Join(model.GetError(code), err))
 			return
 		}
 		c.Header("Content-Type", "application/json")
-		err = json.NewEncoder(c.Writer).Encode(rules)
+		err = json.NewEncoder(c.Writer).Encode(report)
 		if err != nil {
 			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
 			return
@@ -74,11 +128,20 @@ func RulesEndpoint(router gin.IRoutes, _ config.Config, control controller.Contr
 
 	router.GET("/rules/:id", func(c *gin.Context) {
 		id := c.Param("id")
+		token, ok := requireToken(c)
+		if !ok {
+			return
+		}
 		rule, code, err := control.GetRule(id)
 		if err != nil {
 			_ = c.Error(errors.Join(model.GetError(code), err))
 			return
 		}
+		if !token.IsAdmin() && !isOwnTemplateRule(rule, token) {
+			_ = c.Error(errors.Join(model.ErrForbidden, errors.New("only admins may access rules of other users or custom rules")))
+			return
+		}
+		setETag(c, rule.Version)
 		c.Header("Content-Type", "application/json")
 		err = json.NewEncoder(c.Writer).Encode(rule)
 		if err != nil {
@@ -88,17 +151,22 @@ func RulesEndpoint(router gin.IRoutes, _ config.Config, control controller.Contr
 	})
 
 	router.POST("/rules", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
 		rule := model.Rule{}
 		err := c.ShouldBindJSON(&rule)
 		if err != nil {
 			_ = c.Error(errors.Join(model.ErrBadRequest, err))
 			return
 		}
-		respRule, code, err := control.CreateRule(&rule)
+		respRule, code, err := control.CreateRule(&rule, requestid.Get(c))
 		if err != nil {
 			_ = c.Error(errors.Join(model.GetError(code), err))
 			return
 		}
+		setETag(c, respRule.Version)
 		c.Header("Content-Type", "application/json")
 		err = json.NewEncoder(c.Writer).Encode(respRule)
 		if err != nil {
@@ -107,7 +175,123 @@ func RulesEndpoint(router gin.IRoutes, _ config.Config, control controller.Contr
 		}
 	})
 
+	router.POST("/rules/preview", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		if len(c.Query("table")) == 0 {
+			_ = c.Error(errors.Join(model.ErrBadRequest, errors.New("missing query parameter table")))
+			return
+		}
+		table, ok := getTable(c, c.Query("table"))
+		if !ok {
+			return
+		}
+		rule := model.Rule{}
+		err := c.ShouldBindJSON(&rule)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrBadRequest, err))
+			return
+		}
+		preview, code, err := control.PreviewRule(&rule, table)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(preview)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.POST("/rules/:id/dry-run", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		request := model.DryRunRequest{}
+		if c.Request.ContentLength != 0 {
+			err := c.ShouldBindJSON(&request)
+			if err != nil {
+				_ = c.Error(errors.Join(model.ErrBadRequest, err))
+				return
+			}
+		}
+		results, code, err := control.DryRunRule(c.Param("id"), request)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(results)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/rules/:id/tables", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		tables, code, err := control.GetRuleTables(c.Param("id"))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(tables)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/rules/:id/applications", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		applications, code, err := control.ListRuleApplications(c.Param("id"))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(applications)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.POST("/rules/:id/rerun", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		job, code, err := control.RerunRule(c.Param("id"), requestid.Get(c))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(job)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
 	router.PUT("/rules/:id", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
 		rule := model.Rule{}
 		err := c.ShouldBindJSON(&rule)
 		if err != nil {
@@ -119,16 +303,26 @@ func RulesEndpoint(router gin.IRoutes, _ config.Config, control controller.Contr
 			_ = c.Error(errors.Join(model.ErrBadRequest, errors.New("ids don't match")))
 			return
 		}
-		code, err := control.UpdateRule(&rule)
+		respRule, err := updateRule(c, control, &rule)
 		if err != nil {
-			_ = c.Error(errors.Join(model.GetError(code), err))
+			_ = c.Error(err)
+			return
+		}
+		setETag(c, respRule.Version)
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(respRule)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
 			return
 		}
-		c.Status(http.StatusOK)
 	})
 
 	router.DELETE("/rules/:id", func(c *gin.Context) {
 		id := c.Param("id")
+		_, ok := requireRuleAccess(c, control, id)
+		if !ok {
+			return
+		}
 		code, err := control.DeleteRule(id)
 		if err != nil {
 			_ = c.Error(errors.Join(model.GetError(code), err))
@@ -137,3 +331,40 @@ func RulesEndpoint(router gin.IRoutes, _ config.Config, control controller.Contr
 		c.Status(http.StatusOK)
 	})
 }
+
+func getRuleListOptions(c *gin.Context) (options model.RuleListOptions, err error) {
+	options.Limit, options.Offset, err = getLimitOffset(c)
+	if err != nil {
+		return options, err
+	}
+	options.Group = c.Query("group")
+	options.Type = c.Query("type")
+	options.Template = c.Query("template")
+	options.Target = c.Query("target")
+	options.User = c.Query("user")
+	options.Role = c.Query("role")
+	options.Owner = c.Query("owner")
+	options.Sort = c.Query("sort")
+	options.Order = c.Query("order")
+	options.CompletedRun, err = getOptionalBool(c, "completed_run")
+	if err != nil {
+		return options, err
+	}
+	options.HasErrors, err = getOptionalBool(c, "has_errors")
+	if err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+func getOptionalBool(c *gin.Context, key string) (*bool, error) {
+	str := c.Query(key)
+	if len(str) == 0 {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(str)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -0,0 +1,120 @@
+/*
+ *    Copyright 2026 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	endpoints = append(endpoints, TablesEndpoint)
+}
+
+func TablesEndpoint(router gin.IRoutes, _ config.Config, control controller.Controller) {
+	router.GET("/tables/:table/rules", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		table, ok := getTable(c, c.Param("table"))
+		if !ok {
+			return
+		}
+		tableRules, code, err := control.GetTableRules(table)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(tableRules)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/tables/:table/applications", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		table, ok := getTable(c, c.Param("table"))
+		if !ok {
+			return
+		}
+		applications, code, err := control.ListTableApplications(table)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(applications)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.POST("/tables/:table/apply", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		table, ok := getTable(c, c.Param("table"))
+		if !ok {
+			return
+		}
+		useDeleteTemplate, err := getOptionalBool(c, "delete")
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrBadRequest, err))
+			return
+		}
+		job, code, err := control.QueueApplyAllRulesForTable(table, useDeleteTemplate != nil && *useDeleteTemplate, requestid.Get(c))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(job)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+}
+
+// maxTableNameLength is the maximum length of identifiers in PostgreSQL.
+const maxTableNameLength = 63
+
+// getTable checks that table can be the name of a table. Otherwise, model.ErrBadRequest is reported.
+// Whether the table exists is checked by the controller.
+func getTable(c *gin.Context, table string) (string, bool) {
+	if len(table) == 0 || len(table) > maxTableNameLength || !utf8.ValidString(table) || strings.ContainsRune(table, 0) {
+		_ = c.Error(errors.Join(model.ErrBadRequest, errors.New("invalid table name")))
+		return "", false
+	}
+	return table, true
+}
@@ -20,11 +20,12 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
-	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
 )
 
@@ -33,23 +34,98 @@ func init() {
 }
 
 func TemplateRulesEndpoint(router gin.IRoutes, _ config.Config, control controller.Controller) {
+	router.GET("/template-rules", func(c *gin.Context) {
+		token, ok := requireToken(c)
+		if !ok {
+			return
+		}
+		options, err := getRuleListOptions(c)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrBadRequest, err))
+			return
+		}
+		if !token.IsAdmin() {
+			options.Owner = token.GetUserId()
+		}
+		templateRules, total, code, err := control.ListTemplateRules(options)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(templateRules)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/template-rules/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		_, ok := requireRuleAccess(c, control, id)
+		if !ok {
+			return
+		}
+		templateRule, code, err := control.GetTemplateRule(id)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		setETag(c, templateRule.Version)
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(templateRule)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.DELETE("/template-rules/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		_, ok := requireRuleAccess(c, control, id)
+		if !ok {
+			return
+		}
+		_, code, err := control.GetTemplateRule(id)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		code, err = control.DeleteRule(id)
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
 	router.POST("/template-rules", func(c *gin.Context) {
+		token, ok := requireToken(c)
+		if !ok {
+			return
+		}
 		templateRule := model.TemplateRule{}
 		err := c.ShouldBindJSON(&templateRule)
 		if err != nil {
 			_ = c.Error(errors.Join(model.ErrBadRequest, err))
 			return
 		}
+		if !token.IsAdmin() && !isOwnedBy(templateRule.Users, templateRule.Roles, token) {
+			_ = c.Error(errors.Join(model.ErrForbidden, errors.New("users must be set to yourself and roles must be empty")))
+			return
+		}
 		rule, err := templateRule.Rule()
 		if err != nil {
 			_ = c.Error(errors.Join(model.ErrBadRequest, err))
 			return
 		}
-		respRule, code, err := control.CreateRule(rule)
+		respRule, code, err := control.CreateRule(rule, requestid.Get(c))
 		if err != nil {
 			_ = c.Error(errors.Join(model.GetError(code), err))
 			return
 		}
+		setETag(c, respRule.Version)
 		c.Header("Content-Type", "application/json")
 		err = json.NewEncoder(c.Writer).Encode(respRule)
 		if err != nil {
@@ -70,27 +146,39 @@ func TemplateRulesEndpoint(router gin.IRoutes, _ config.Config, control controll
 			_ = c.Error(errors.Join(model.ErrBadRequest, errors.New("ids don't match")))
 			return
 		}
-		rule, err := caRule.Rule()
-		if err != nil {
-			_ = c.Error(errors.Join(model.ErrBadRequest, err))
+		token, ok := requireRuleAccess(c, control, id)
+		if !ok {
+			return
+		}
+		if !token.IsAdmin() && !isOwnedBy(caRule.Users, caRule.Roles, token) {
+			_ = c.Error(errors.Join(model.ErrForbidden, errors.New("users must be set to yourself and roles must be empty")))
 			return
 		}
-		code, err := control.UpdateRule(rule)
+		if !token.IsAdmin() {
+			current, code, err := control.GetTemplateRule(id)
+			if err != nil {
+				_ = c.Error(errors.Join(model.GetError(code), err))
+				return
+			}
+			err = caRule.CheckEditable(*current)
+			if err != nil {
+				_ = c.Error(errors.Join(model.ErrForbidden, err))
+				return
+			}
+		}
+		rule, err := caRule.Rule()
 		if err != nil {
-			_ = c.Error(errors.Join(model.GetError(code), err))
+			_ = c.Error(errors.Join(model.ErrBadRequest, err))
 			return
 		}
-		c.Status(http.StatusOK)
-	})
-
-	router.GET("/templates", func(c *gin.Context) {
-		ts, err := templates.New(nil)
+		respRule, err := updateRule(c, control, rule)
 		if err != nil {
-			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			_ = c.Error(err)
 			return
 		}
+		setETag(c, respRule.Version)
 		c.Header("Content-Type", "application/json")
-		err = json.NewEncoder(c.Writer).Encode(ts.Templates)
+		err = json.NewEncoder(c.Writer).Encode(respRule)
 		if err != nil {
 			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
 			return
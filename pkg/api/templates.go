@@ -0,0 +1,173 @@
+/*
+ *    Copyright 2026 InfAI (CC SES)
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/controller"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	endpoints = append(endpoints, TemplatesEndpoint)
+}
+
+func TemplatesEndpoint(router gin.IRoutes, _ config.Config, control controller.Controller) {
+	router.GET("/templates", func(c *gin.Context) {
+		_, ok := requireToken(c)
+		if !ok {
+			return
+		}
+		list, code, err := control.ListTemplates()
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(list)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/template-targets", func(c *gin.Context) {
+		_, ok := requireToken(c)
+		if !ok {
+			return
+		}
+		targets, code, err := control.ListTemplateRuleTargets()
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(targets)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.GET("/templates/:name", func(c *gin.Context) {
+		_, ok := requireToken(c)
+		if !ok {
+			return
+		}
+		tmpl, code, err := control.GetTemplate(c.Param("name"))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(tmpl)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	setTemplate := func(create bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			_, ok := requireAdmin(c)
+			if !ok {
+				return
+			}
+			tmpl := templates.Template{}
+			err := c.ShouldBindJSON(&tmpl)
+			if err != nil {
+				_ = c.Error(errors.Join(model.ErrBadRequest, err))
+				return
+			}
+			name := c.Param("name")
+			if len(tmpl.Name) > 0 && tmpl.Name != name {
+				_ = c.Error(errors.Join(model.ErrBadRequest, errors.New("names don't match")))
+				return
+			}
+			tmpl.Name = name
+			result, code, err := control.SetTemplate(tmpl, create)
+			if err != nil {
+				_ = c.Error(errors.Join(model.GetError(code), err))
+				return
+			}
+			c.Header("Content-Type", "application/json")
+			err = json.NewEncoder(c.Writer).Encode(result)
+			if err != nil {
+				_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+				return
+			}
+		}
+	}
+	router.POST("/templates/:name", setTemplate(true))
+	router.PUT("/templates/:name", setTemplate(false))
+
+	router.DELETE("/templates/:name", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		code, err := control.DeleteTemplate(c.Param("name"))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	router.GET("/templates/:name/outdated-rules", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		templateRules, code, err := control.ListOutdatedTemplateRules(c.Param("name"))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(templateRules)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+
+	router.POST("/templates/:name/upgrade", func(c *gin.Context) {
+		_, ok := requireAdmin(c)
+		if !ok {
+			return
+		}
+		job, code, err := control.UpgradeTemplateRules(c.Param("name"), requestid.Get(c))
+		if err != nil {
+			_ = c.Error(errors.Join(model.GetError(code), err))
+			return
+		}
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(job)
+		if err != nil {
+			_ = c.Error(errors.Join(model.ErrInternalServerError, err))
+			return
+		}
+	})
+}
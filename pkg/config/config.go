@@ -45,9 +45,10 @@ type Config struct {
 
 	PermissionsV2Url string `json:"permissions_v2_url"`
 
-	KeycloakUrl          string `json:"keycloak_url"`
-	KeycloakClientId     string `json:"keycloak_client_id"`
-	KeycloakClientSecret string `json:"keycloak_client_secret"`
+	KeycloakUrl                 string `json:"keycloak_url"`
+	KeycloakClientId            string `json:"keycloak_client_id"`
+	KeycloakClientSecret        string `json:"keycloak_client_secret"`
+	InsecureSkipTokenValidation bool   `json:"insecure_skip_token_validation"` // accept tokens without checking their signature, only for development
 
 	DeviceIdPrefix  string `json:"device_id_prefix"`
 	ServiceIdPrefix string `json:"service_id_prefix"`
@@ -60,6 +61,34 @@ type Config struct {
 	DefaultTimezone     string `json:"default_timezone"`
 	DeviceRepoUrl       string `json:"device_repo_url"`
 	LogHandler          string `json:"log_handler"`
+
+	TemplateRuleTargets []TemplateRuleTarget `json:"template_rule_targets"` // in addition to the built-in device and export targets
+
+	SqlPolicyDisabled          bool     `json:"sql_policy_disabled"`           // execute rendered rule SQL without checking it, see policy.Policy
+	SqlPolicyAllowedStatements []string `json:"sql_policy_allowed_statements"` // statement kinds like create_stmt, defaults to policy.DefaultAllowedStatements
+	SqlPolicyAllowedDropTypes  []string `json:"sql_policy_allowed_drop_types"` // object types other than relations that may be dropped, like function
+	SqlPolicyAllowedFunctions  []string `json:"sql_policy_allowed_functions"`  // functions SELECT and CALL statements may call, defaults to policy.DefaultAllowedFunctions
+
+	LockMode         string `json:"lock_mode"`         // one of LockModeTable (default) and LockModeGlobal
+	ApplyConcurrency int    `json:"apply_concurrency"` // maximum number of tables rules are applied to concurrently, defaults to 4
+	JobConcurrency   int    `json:"job_concurrency"`   // maximum number of jobs run concurrently by an instance, defaults to 2
+	StrictOrdering   bool   `json:"strict_ordering"`   // run, update, upgrade and delete a rule on all tables one after another in a single transaction
+
+	ReconcileInterval  string `json:"reconcile_interval"`   // interval of drift detection, disabled if empty
+	ReconcileAutoApply bool   `json:"reconcile_auto_apply"` // apply all rules again to tables with drift
+}
+
+// LockModeTable only serializes operations on the same table. Operations on different tables run concurrently.
+const LockModeTable = "table"
+
+// LockModeGlobal serializes all operations changing tables across all instances, as in earlier versions.
+const LockModeGlobal = "global"
+
+// TemplateRuleTarget is a family of tables template rules can be created for.
+type TemplateRuleTarget struct {
+	Name           string   `json:"name"`
+	TableRegEx     string   `json:"table_reg_ex"`
+	EditableFields []string `json:"editable_fields,omitempty"` // fields of template rules non-admins may change, all if empty
 }
 
 // loads config from json in location and used environment variables (e.g ZookeeperUrl --> ZOOKEEPER_URL)
@@ -126,7 +155,12 @@ func HandleEnvironmentVars(config *Config) {
 				f, _ := strconv.ParseFloat(envValue, 64)
 				configValue.FieldByName(fieldName).SetFloat(f)
 			}
-			if configValue.FieldByName(fieldName).Kind() == reflect.Slice {
+			if configValue.FieldByName(fieldName).Kind() == reflect.Slice && configValue.FieldByName(fieldName).Type().Elem().Kind() != reflect.String {
+				err := json.Unmarshal([]byte(envValue), configValue.FieldByName(fieldName).Addr().Interface())
+				if err != nil {
+					log.Println("invalid json in environment variable: ", envName, err)
+				}
+			} else if configValue.FieldByName(fieldName).Kind() == reflect.Slice {
 				val := []string{}
 				for _, element := range strings.Split(envValue, ",") {
 					val = append(val, strings.TrimSpace(element))
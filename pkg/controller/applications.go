@@ -0,0 +1,109 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+// ListRuleApplications lists the tables the rule with the given id is applied to.
+func (this *impl) ListRuleApplications(id string) (applications []model.RuleApplication, code int, err error) {
+	_, code, err = this.GetRule(id)
+	if err != nil {
+		return nil, code, err
+	}
+	applications, err = this.db.ListApplications(id, "")
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return applications, http.StatusOK, nil
+}
+
+// ListTableApplications lists the rules applied to the table. Returns http.StatusNotFound if the table does not exist.
+func (this *impl) ListTableApplications(table string) (applications []model.RuleApplication, code int, err error) {
+	_, code, err = this.getColumns(table)
+	if err != nil {
+		return nil, code, err
+	}
+	applications, err = this.db.ListApplications("", table)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return applications, http.StatusOK, nil
+}
+
+// renderRule renders the command or delete template of the rule for the table of tableInfo. If the rule has been
+// applied to the table before, the delete SQL rendered at that time is used instead of the delete template, so
+// that the objects created back then are deleted even if the owners of the table changed in the meantime.
+// Errors rendering the template are returned with http.StatusBadRequest.
+func (this *impl) renderRule(rule model.Rule, tableInfo model.TableInfo, isDelete bool, tx *sql.Tx) (query string, code int, err error) {
+	if !isDelete {
+		query, err = renderTemplate(rule.CommandTemplate, tableInfo)
+		if err != nil {
+			return "", http.StatusBadRequest, err
+		}
+		return query, http.StatusOK, nil
+	}
+	application, err := this.db.GetApplication(rule.Id, tableInfo.Table, tx)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return "", http.StatusInternalServerError, err
+	}
+	if err == nil && len(application.DeleteSql) > 0 {
+		return application.DeleteSql, http.StatusOK, nil
+	}
+	query, err = renderTemplate(rule.DeleteTemplate, tableInfo)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	return query, http.StatusOK, nil
+}
+
+// recordApplication saves that the rendered command template of the rule has been applied to the table of
+// tableInfo, together with the rendered delete template. After the delete template has been applied, the
+// application is removed.
+func (this *impl) recordApplication(rule model.Rule, tableInfo model.TableInfo, query string, isDelete bool, tx *sql.Tx) error {
+	if isDelete {
+		return this.db.DeleteApplication(rule.Id, tableInfo.Table, tx)
+	}
+	deleteSql, err := renderTemplate(rule.DeleteTemplate, tableInfo)
+	if err != nil {
+		deleteSql = "" // the delete template is rendered again when needed and reports the error then
+	}
+	return this.db.SetApplication(&model.RuleApplication{
+		RuleId:      rule.Id,
+		Table:       tableInfo.Table,
+		Group:       rule.Group,
+		RuleVersion: rule.Version,
+		CommandHash: commandHash(query),
+		DeleteSql:   deleteSql,
+		Applied:     time.Now(),
+	}, tx)
+}
+
+// commandHash is the hex encoded SHA-256 of the rendered command template, see model.RuleApplication.
+func commandHash(query string) string {
+	hash := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+	"github.com/hashicorp/go-uuid"
+)
+
+const bundlePageSize = 1000
+
+// ExportRules writes the definitions of all rules, custom and template rules alike, to the bundle. Rules are read
+// page by page and written as they are read. The bundle is closed if all rules were written.
+func (this *impl) ExportRules(bundle *model.RuleBundleWriter) (code int, err error) {
+	options := model.RuleListOptions{Limit: bundlePageSize}
+	for {
+		page, _, err := this.db.ListRules(options)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		for _, rule := range page {
+			rule.Errors = nil
+			rule.CompletedRun = false
+			rule.Version = 0
+			err = bundle.Write(rule)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		if len(page) < bundlePageSize {
+			break
+		}
+		options.Offset += len(page)
+	}
+	err = bundle.Close()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// ImportRules creates, updates and deletes rules according to the bundle and options.
+// Nothing is changed if the options request a dry run or any rule of the bundle is invalid.
+// Rules are created and updated the same way as by CreateRule and UpdateRule, errors are reported per rule.
+func (this *impl) ImportRules(bundle model.RuleBundle, options model.RuleImportOptions, requestId string) (report *model.RuleImportReport, code int, err error) {
+	err = options.Validate()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err = bundle.Validate()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	existingRules, err := this.listAllRules(model.RuleListOptions{})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	existing := map[string]bool{}
+	for _, rule := range existingRules {
+		existing[rule.Id] = true
+	}
+
+	report = &model.RuleImportReport{DryRun: options.DryRun, Results: []model.RuleImportResult{}}
+	valid := true
+	imported := map[string]bool{}
+	for _, rule := range bundle.Rules {
+		result := model.RuleImportResult{Id: rule.Id, Action: model.RuleImportActionCreate}
+		if existing[rule.Id] {
+			result.Action = model.RuleImportActionUpdate
+			if options.Mode == model.RuleImportModeCreateOnly {
+				result.Action = model.RuleImportActionSkip
+			}
+		}
+		err = validateRule(rule)
+		if err == nil && len(rule.Id) > 0 {
+			if _, uuidErr := uuid.ParseUUID(rule.Id); uuidErr != nil {
+				err = errors.New("invalid id: " + uuidErr.Error())
+			} else if imported[rule.Id] {
+				err = errors.New("duplicate id in bundle")
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			valid = false
+		}
+		imported[rule.Id] = true
+		report.Results = append(report.Results, result)
+	}
+	if options.Mode == model.RuleImportModeReplace {
+		for _, rule := range existingRules {
+			if !imported[rule.Id] {
+				report.Results = append(report.Results, model.RuleImportResult{Id: rule.Id, Action: model.RuleImportActionDelete})
+			}
+		}
+	}
+	if options.DryRun || !valid {
+		return report, http.StatusOK, nil
+	}
+
+	for i := range report.Results {
+		result := &report.Results[i]
+		var typed *model.TypedRule
+		switch result.Action {
+		case model.RuleImportActionCreate:
+			rule := bundle.Rules[i].Copy()
+			if len(rule.Id) == 0 {
+				rule.Id, err = uuid.GenerateUUID()
+				if err != nil {
+					result.Error = err.Error()
+					continue
+				}
+				result.Id = rule.Id
+			}
+			typed, _, err = this.createRule(&rule, requestId)
+		case model.RuleImportActionUpdate:
+			rule := bundle.Rules[i].Copy()
+			rule.Version = 0 // versions are not portable between instances
+			typed, _, err = this.UpdateRule(&rule, requestId)
+		case model.RuleImportActionDelete:
+			_, err = this.DeleteRule(result.Id)
+		default:
+			continue
+		}
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		if typed != nil {
+			result.JobId = typed.JobId
+		}
+	}
+	report.Applied = true
+	return report, http.StatusOK, nil
+}
+
+// listAllRules lists all rules matching the filters of options. Limit and offset are ignored.
+func (this *impl) listAllRules(options model.RuleListOptions) (rules []model.Rule, err error) {
+	rules = []model.Rule{}
+	options.Limit = bundlePageSize
+	for {
+		options.Offset = len(rules)
+		page, _, err := this.db.ListRules(options)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, page...)
+		if len(page) < bundlePageSize {
+			return rules, nil
+		}
+	}
+}
+
+// validateRule checks that the TableRegEx and templates of the rule can be parsed.
+func validateRule(rule model.Rule) error {
+	if len(rule.TableRegEx) == 0 {
+		return errors.New("missing table_reg_ex")
+	}
+	_, err := regexp.Compile(rule.TableRegEx)
+	if err != nil {
+		return errors.New("invalid table_reg_ex: " + err.Error())
+	}
+	_, err = templates.Parse(rule.CommandTemplate)
+	if err != nil {
+		return errors.New("invalid command_template: " + err.Error())
+	}
+	_, err = templates.Parse(rule.DeleteTemplate)
+	if err != nil {
+		return errors.New("invalid delete_template: " + err.Error())
+	}
+	return nil
+}
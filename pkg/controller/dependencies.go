@@ -0,0 +1,59 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+)
+
+// checkDependencies returns an error if saving the rule or the template would introduce a dependency cycle
+// between groups. Rules of a group may apply to tables independently of rules and templates of other groups,
+// so the dependencies of all rules and templates have to be free of cycles. Either rule or tmpl may be nil.
+// The dependencies are locked until tx ends, so the rule or template has to be saved before tx ends to prevent
+// concurrent changes from introducing a cycle.
+func (this *impl) checkDependencies(rule *model.Rule, tmpl *templates.Template, tx *sql.Tx) (code int, err error) {
+	err = this.db.LockDependencies(tx)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	ruleId, templateName := "", ""
+	if rule != nil {
+		ruleId = rule.Id
+	}
+	if tmpl != nil {
+		templateName = tmpl.Name
+	}
+	deps, err := this.db.ListDependencies(ruleId, templateName, tx)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if rule != nil {
+		deps.Add(rule.Group, rule.DependsOn)
+	}
+	if tmpl != nil {
+		deps.Add(tmpl.Group, tmpl.DependsOn)
+	}
+	err = deps.Cycle()
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
@@ -21,9 +21,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
@@ -38,7 +41,9 @@ import (
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/policy"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/security"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
 	"github.com/hashicorp/go-uuid"
 	"golang.org/x/exp/slices"
 )
@@ -57,8 +62,17 @@ type impl struct {
 	slowMuxLock                 time.Duration
 	defaultTimezone             string
 	deviceRepoClient            deviceRepo.Interface
+	jobNotify                   chan struct{}
+	policy                      *policy.Policy // nil if disabled
+	lockMode                    string
+	tableSlots                  chan struct{} // bounds the number of tables rules are applied to concurrently
+	jobSlots                    chan struct{} // bounds the number of jobs run concurrently
+	strictOrdering              bool
 }
 
+const defaultApplyConcurrency = 4
+const defaultJobConcurrency = 2
+
 func New(c config.Config, db database.DB, permv2 perm.Client, deviceRepoClient deviceRepo.Interface, fatal func(error), ctx context.Context, wg *sync.WaitGroup) (Controller, bool, error) {
 	oidClient, err := security.NewClient(c.KeycloakUrl, c.KeycloakClientId, c.KeycloakClientSecret)
 	if err != nil {
@@ -71,7 +85,40 @@ func New(c config.Config, db database.DB, permv2 perm.Client, deviceRepoClient d
 			return nil, false, err
 		}
 	}
-	controller := &impl{db: db, permv2: permv2, oidClient: oidClient, deviceIdPrefix: c.DeviceIdPrefix, serviceIdPrefix: c.ServiceIdPrefix, mux: sync.Mutex{}, fatal: fatal, debug: c.Debug, slowMuxLock: slowMuxLock, defaultTimezone: c.DefaultTimezone, deviceRepoClient: deviceRepoClient}
+	controller := &impl{db: db, permv2: permv2, oidClient: oidClient, deviceIdPrefix: c.DeviceIdPrefix, serviceIdPrefix: c.ServiceIdPrefix, mux: sync.Mutex{}, fatal: fatal, debug: c.Debug, slowMuxLock: slowMuxLock, defaultTimezone: c.DefaultTimezone, deviceRepoClient: deviceRepoClient, jobNotify: make(chan struct{}, 1)}
+	if !c.SqlPolicyDisabled {
+		controller.policy = policy.New(c.SqlPolicyAllowedStatements, c.SqlPolicyAllowedDropTypes, c.SqlPolicyAllowedFunctions)
+	}
+	switch c.LockMode {
+	case "", config.LockModeTable:
+		controller.lockMode = config.LockModeTable
+	case config.LockModeGlobal:
+		controller.lockMode = config.LockModeGlobal
+	default:
+		return nil, false, errors.New("unknown lock mode " + c.LockMode)
+	}
+	applyConcurrency := defaultApplyConcurrency
+	if c.ApplyConcurrency > 0 {
+		applyConcurrency = c.ApplyConcurrency
+	}
+	controller.tableSlots = make(chan struct{}, applyConcurrency)
+	jobConcurrency := defaultJobConcurrency
+	if c.JobConcurrency > 0 {
+		jobConcurrency = c.JobConcurrency
+	}
+	controller.jobSlots = make(chan struct{}, jobConcurrency)
+	controller.strictOrdering = c.StrictOrdering
+	reconcileInterval := 0 * time.Nanosecond
+	if len(c.ReconcileInterval) > 0 {
+		reconcileInterval, err = time.ParseDuration(c.ReconcileInterval)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	err = controller.migrateTemplateRules()
+	if err != nil {
+		return nil, false, err
+	}
 	kafkaConsumer, needsSync, err := controller.setupKafka(c, ctx, wg)
 	if err != nil {
 		return nil, false, err
@@ -86,10 +133,14 @@ func New(c config.Config, db database.DB, permv2 perm.Client, deviceRepoClient d
 	if err != nil {
 		return nil, false, err
 	}
+	controller.startJobWorker(ctx, wg)
+	if reconcileInterval > 0 {
+		controller.startReconciler(reconcileInterval, c.ReconcileAutoApply, ctx, wg)
+	}
 	return controller, needsSync, err
 }
 
-func (this *impl) CreateRule(rule *model.Rule) (res *model.TypedRule, code int, err error) {
+func (this *impl) CreateRule(rule *model.Rule, requestId string) (res *model.TypedRule, code int, err error) {
 	myRule := rule.Copy()
 	if len(myRule.Id) != 0 {
 		return nil, http.StatusBadRequest, errors.New("may not specify Id yourself")
@@ -98,13 +149,31 @@ func (this *impl) CreateRule(rule *model.Rule) (res *model.TypedRule, code int,
 	if err != nil {
 		return nil, http.StatusBadRequest, err
 	}
+	return this.createRule(&myRule, requestId)
+}
+
+// createRule saves the rule with the id already set and queues a job applying it to all matching tables.
+func (this *impl) createRule(myRule *model.Rule, requestId string) (res *model.TypedRule, code int, err error) {
 	myRule.CompletedRun = false
+	myRule.Version = 1
+	job, err := newJob(model.JobTypeRunRule, myRule.Id, requestId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 	tx, cancel, err := this.db.GetTx()
 	defer cancel()
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
-	err = this.db.InsertRule(&myRule, tx)
+	code, err = this.checkDependencies(myRule, nil, tx)
+	if err != nil {
+		return nil, code, err
+	}
+	err = this.db.InsertRule(myRule, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	err = this.db.InsertJob(job, tx)
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
@@ -112,35 +181,73 @@ func (this *impl) CreateRule(rule *model.Rule) (res *model.TypedRule, code int,
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
-	runRule := myRule.Copy()
-	go this.runRule(&runRule)
+	this.notifyJobWorker()
 	typed, err := myRule.Type()
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
+	typed.JobId = job.Id
 	return typed, http.StatusOK, nil
 }
-func (this *impl) UpdateRule(rule *model.Rule) (code int, err error) {
+
+// UpdateRule saves the rule and queues a job replacing the previous version on all tables, see updateRule.
+func (this *impl) UpdateRule(rule *model.Rule, requestId string) (res *model.TypedRule, code int, err error) {
+	job, err := newJob(model.JobTypeUpdateRule, rule.Id, requestId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 	tx, cancel, err := this.db.GetTx()
 	defer cancel()
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
+	}
+	code, err = this.checkDependencies(rule, nil, tx)
+	if err != nil {
+		return nil, code, err
 	}
 	rule.CompletedRun = false
+	current, err := this.db.GetRule(rule.Id, tx)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if rule.Version == 0 {
+		// no version given by the caller, overwrite the current version
+		rule.Version = current.Version
+	}
+	job.PreviousRule = current
 	err = this.db.UpdateRule(rule, tx)
 	if err != nil {
 		if errors.Is(err, database.ErrNotFound) {
-			return http.StatusNotFound, err
+			return nil, http.StatusNotFound, err
 		}
-		return http.StatusInternalServerError, err
+		if errors.Is(err, database.ErrVersionMismatch) {
+			return nil, http.StatusConflict, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	err = this.db.InsertJob(job, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
 	}
 	err = tx.Commit()
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
-	go this.runRule(rule)
-	return http.StatusOK, nil
+	this.notifyJobWorker()
+	typed, err := rule.Type()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	typed.JobId = job.Id
+	return typed, http.StatusOK, nil
 }
+
+// DeleteRule runs the delete template of the rule on all matching tables and deletes the rule if it succeeded on every
+// table. Each table is changed in a transaction of its own, see forEachTableTx, so tables the delete template succeeded
+// on stay changed if it failed on another table. With StrictOrdering, no table is changed in that case.
 func (this *impl) DeleteRule(id string) (code int, err error) {
 	err = this.lock()
 	if err != nil {
@@ -151,27 +258,42 @@ func (this *impl) DeleteRule(id string) (code int, err error) {
 		this.unlock()
 		this.logDebug("unlocked db for DeleteRule " + id)
 	}()
-	tx, cancel, err := this.db.GetTx()
-	defer cancel()
+	tables, err := this.findMatchingTables([]string{id})
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	tables, err := this.db.FindMatchingTables([]string{id}, tx)
+	tx, cancel, err := this.getStrictTx()
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	for _, table := range tables {
-		allRanOk, code, err := this.applyRulesForTable(table, true, []string{id}, tx)
+	defer cancel()
+	errs := this.forEachTableTx(tables, tx, func(table string, tx *sql.Tx) error {
+		allRanOk, _, err := this.applyRulesForTable(table, true, []string{id}, tx)
 		if err != nil {
-			return code, err
+			return errors.New(table + ": " + err.Error())
 		}
 		if !allRanOk {
-			return http.StatusBadRequest, errors.New("rule has delete template that finished with errors. " +
-				"Will not delete rule to avoid inconsistencies")
+			return fmt.Errorf("%s: %w", table, errDeleteTemplateFailed)
 		}
+		return nil
+	})
+	if len(errs) > 0 {
+		_ = finishStrictTx(tx, errs)
+		if slices.ContainsFunc(errs, func(err error) bool { return errors.Is(err, errDeleteTemplateFailed) }) {
+			return http.StatusBadRequest, errors.Join(errs...)
+		}
+		return http.StatusInternalServerError, errors.Join(errs...)
+	}
+	if tx == nil {
+		tx, cancel, err = this.db.GetTx()
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		defer cancel()
 	}
 	err = this.db.DeleteRule(id, tx)
 	if err != nil {
+		_ = tx.Rollback()
 		if errors.Is(err, database.ErrNotFound) {
 			return http.StatusNotFound, err
 		}
@@ -183,6 +305,10 @@ func (this *impl) DeleteRule(id string) (code int, err error) {
 	}
 	return http.StatusOK, nil
 }
+
+var errDeleteTemplateFailed = errors.New("rule has delete template that finished with errors. " +
+	"Will not delete rule to avoid inconsistencies")
+
 func (this *impl) GetRule(id string) (typedRule *model.TypedRule, code int, err error) {
 	tx, cancel, err := this.db.GetTx()
 	defer cancel()
@@ -202,25 +328,31 @@ func (this *impl) GetRule(id string) (typedRule *model.TypedRule, code int, err
 	}
 	return typed, http.StatusOK, nil
 }
-func (this *impl) ListRules(limit, offset int) (typedRules []model.TypedRule, code int, err error) {
-	rules, err := this.db.ListRules(limit, offset)
+func (this *impl) ListRules(options model.RuleListOptions) (typedRules []model.TypedRule, total int, code int, err error) {
+	err = options.Validate()
 	if err != nil {
-		return nil, http.StatusInternalServerError, err
+		return nil, 0, http.StatusBadRequest, err
+	}
+	rules, total, err := this.db.ListRules(options)
+	if err != nil {
+		return nil, 0, http.StatusInternalServerError, err
 	}
 	typedRules = []model.TypedRule{}
 	for _, rule := range rules {
 		rule := rule
 		typed, err := rule.Type()
 		if err != nil {
-			return nil, http.StatusInternalServerError, err
+			return nil, 0, http.StatusInternalServerError, err
 		}
 		typedRules = append(typedRules, *typed)
 	}
-	return typedRules, http.StatusOK, nil
+	return typedRules, total, http.StatusOK, nil
 }
 
-var exportTableMatch = regexp.MustCompile("userid:(.{22})_export:(.{22}).*")
-var deviceTableMatch = regexp.MustCompile("device:(.{22})_service:(.{22}).*")
+// Ids are shortened to 22 characters of base64url. Tables derived from export and device tables may add suffixes
+// like _ld separated by an underscore.
+var exportTableMatch = regexp.MustCompile("^userid:([A-Za-z0-9_-]{22})_export:([A-Za-z0-9_-]{22})(?:_.*)?$")
+var deviceTableMatch = regexp.MustCompile("^device:([A-Za-z0-9_-]{22})_service:([A-Za-z0-9_-]{22})(?:_.*)?$")
 
 func (this *impl) ApplyAllRulesForTable(table string, useDeleteTemplateInstead bool) (code int, err error) {
 	err = this.lock()
@@ -232,41 +364,150 @@ func (this *impl) ApplyAllRulesForTable(table string, useDeleteTemplateInstead b
 		this.unlock()
 		this.logDebug("unlocked db for ApplyAllRulesForTable " + table)
 	}()
-	tx, cancel, err := this.db.GetTx()
-	defer cancel()
-	_, code, err = this.applyRulesForTable(table, useDeleteTemplateInstead, nil, tx)
+	_, code, err = this.applyRulesForTableInTx(table, useDeleteTemplateInstead, nil)
+	return code, err
+}
+
+func (this *impl) applyRulesForTable(table string, useDeleteTemplateInstead bool, limitToRuleIds []string, tx *sql.Tx) (allRanOk bool, code int, err error) {
+	results, code, err := this.applyRules(table, useDeleteTemplateInstead, limitToRuleIds, false, tx)
 	if err != nil {
-		return code, err
+		return false, code, err
 	}
-	err = tx.Commit()
-	if err != nil {
-		return http.StatusInternalServerError, err
+	for _, result := range results {
+		if result.err != nil {
+			return false, code, nil
+		}
 	}
-	return code, err
+	return true, code, nil
 }
 
-func (this *impl) applyRulesForTable(table string, useDeleteTemplateInstead bool, limitToRuleIds []string, tx *sql.Tx) (allRanOk bool, code int, err error) {
+// ruleResult is the outcome of applying a single rule to a table.
+type ruleResult struct {
+	rule  model.Rule
+	query string
+	err   error
+}
+
+// applyRules applies all matching rules to the table and reports the outcome per rule.
+// Failed rules are rolled back to a savepoint. Unless dryRun is set, their errors are saved to the rule.
+// The table is locked until tx ends, see database.DB.LockTable. Unless dryRun is set, successful applications
+// are recorded, see recordApplication.
+// Rules are applied after the rules of the groups they depend on and deleted in reverse order.
+func (this *impl) applyRules(table string, useDeleteTemplateInstead bool, limitToRuleIds []string, dryRun bool, tx *sql.Tx) (results []ruleResult, code int, err error) {
 	if limitToRuleIds != nil {
 		this.logDebug("applying rules to table " + table + " limited to rule ids " + strings.Join(limitToRuleIds, ", "))
 	} else {
 		this.logDebug("applying rules to table " + table + " unlimited to any rule ids")
 	}
 
-	allRanOk = true
-	tableInfo := model.TableInfo{Table: table, Roles: []string{}, Timezone: this.defaultTimezone}
+	err = this.db.LockTable(table, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	tableInfo, code, err := this.getTableInfo(table)
+	if err != nil {
+		return nil, code, err
+	}
+
+	this.logDebug(table + " belongs to users " + strings.Join(tableInfo.UserIds, ", ") + " and roles " + strings.Join(tableInfo.Roles, ", "))
+	rules, err := this.db.FindMatchingRulesWithOwnerInfo(table, tableInfo.UserIds, tableInfo.Roles, limitToRuleIds, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	rules, err = model.SortByDependencies(rules)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if useDeleteTemplateInstead {
+		slices.Reverse(rules)
+	}
+
+	if len(rules) > 0 {
+		tableInfo.Columns, err = this.db.GetColumns(table)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	results = []ruleResult{}
+	for _, rule := range rules {
+		result, code, err := this.applyRule(rule, tableInfo, useDeleteTemplateInstead, dryRun, tx)
+		if err != nil {
+			return nil, code, err
+		}
+		results = append(results, result)
+	}
+
+	return results, http.StatusOK, nil
+}
+
+// applyRule applies a single rule to the table of tableInfo, which has to include the columns of the table.
+// A failed rule is rolled back to a savepoint and its error is reported in the result. Unless dryRun is set,
+// the error is saved to the rule and a successful application is recorded, see recordApplication.
+func (this *impl) applyRule(rule model.Rule, tableInfo model.TableInfo, useDeleteTemplateInstead bool, dryRun bool, tx *sql.Tx) (result ruleResult, code int, err error) {
+	this.logDebug("applying rule " + rule.Id + " to table " + tableInfo.Table)
+	savepoint := "rule"
+	_, err = tx.Exec("SAVEPOINT " + savepoint + ";")
+	if err != nil {
+		return result, http.StatusInternalServerError, err
+	}
+	errorhandling := func(ruleErr error) (ruleResult, int, error) {
+		_, err := tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint + ";")
+		if err != nil {
+			return result, http.StatusInternalServerError, err
+		}
+		if !dryRun {
+			err = this.db.AppendRuleError(rule.Id, tableInfo.Table+": "+ruleErr.Error(), tx)
+			if err != nil {
+				return result, http.StatusInternalServerError, err
+			}
+		}
+		return ruleResult{rule: rule, err: ruleErr}, http.StatusOK, nil
+	}
+	tableInfo.Params = rule.Parameters
+	query, code, err := this.renderRule(rule, tableInfo, useDeleteTemplateInstead, tx)
+	if err != nil && code == http.StatusInternalServerError {
+		return result, code, err
+	}
+	if err == nil {
+		err = this.checkPolicy(rule, query, tableInfo, useDeleteTemplateInstead)
+	}
+	if err != nil {
+		return errorhandling(err)
+	}
+	_, err = this.db.Exec(query, tx)
+	if err != nil {
+		return errorhandling(err)
+	}
+	if !dryRun {
+		err = this.recordApplication(rule, tableInfo, query, useDeleteTemplateInstead, tx)
+		if err != nil {
+			return result, http.StatusInternalServerError, err
+		}
+	}
+	return ruleResult{rule: rule, query: query}, http.StatusOK, nil
+}
+
+// getTableInfo resolves the information available to rule templates from the table name.
+// Owners are fetched from permissions-v2 and keycloak, the timezone from the device-repository.
+// Columns are not included.
+func (this *impl) getTableInfo(table string) (tableInfo model.TableInfo, code int, err error) {
+	tableInfo = model.TableInfo{Table: table, Roles: []string{}, Timezone: this.defaultTimezone}
 	matches := exportTableMatch.FindAllStringSubmatch(table, -1)
 	if matches != nil && len(matches[0]) == 3 { // is export table
 		this.logDebug(table + " is an export table")
 		tableInfo.ShortUserId = matches[0][1]
 		longUserId, err := models.LongId(tableInfo.ShortUserId)
 		if err != nil {
-			return false, http.StatusInternalServerError, err
+			return tableInfo, http.StatusInternalServerError, err
 		}
 		tableInfo.UserIds = []string{longUserId}
 		tableInfo.ShortExportId = matches[0][2]
 		tableInfo.ExportId, err = models.LongId(tableInfo.ShortExportId)
 		if err != nil {
-			return false, http.StatusInternalServerError, err
+			return tableInfo, http.StatusInternalServerError, err
 		}
 	} else {
 		matches = deviceTableMatch.FindAllStringSubmatch(table, -1)
@@ -275,24 +516,24 @@ func (this *impl) applyRulesForTable(table string, useDeleteTemplateInstead bool
 			tableInfo.ShortDeviceId = matches[0][1]
 			longDeviceId, err := models.LongId(tableInfo.ShortDeviceId)
 			if err != nil {
-				return false, http.StatusInternalServerError, err
+				return tableInfo, http.StatusInternalServerError, err
 			}
 			tableInfo.DeviceId = this.deviceIdPrefix + longDeviceId
 			tableInfo.ShortServiceId = matches[0][2]
 			longServiceId, err := models.LongId(tableInfo.ShortServiceId)
 			if err != nil {
-				return false, http.StatusInternalServerError, err
+				return tableInfo, http.StatusInternalServerError, err
 			}
 			tableInfo.ServiceId = this.serviceIdPrefix + longServiceId
 			// get Device Owners
 			token, err := this.oidClient.GetToken()
 			if err != nil {
-				return false, http.StatusInternalServerError, err
+				return tableInfo, http.StatusInternalServerError, err
 			}
 			resource, err, _ := this.permv2.GetResource(token.JwtToken(), "devices", tableInfo.DeviceId)
 			if err != nil {
 				err = errors.New(err.Error() + tableInfo.DeviceId)
-				return false, http.StatusInternalServerError, err
+				return tableInfo, http.StatusInternalServerError, err
 			}
 			tableInfo.Roles = []string{}
 			for group, groupRights := range resource.RolePermissions { // groups are roles...
@@ -308,7 +549,7 @@ func (this *impl) applyRulesForTable(table string, useDeleteTemplateInstead bool
 			devices, err, code := this.deviceRepoClient.ListDevices(perm.InternalAdminToken, deviceRepoModel.DeviceListOptions{Ids: []string{tableInfo.DeviceId}})
 			if err != nil && code != http.StatusNotFound {
 				err = errors.New(err.Error() + tableInfo.DeviceId)
-				return false, http.StatusInternalServerError, err
+				return tableInfo, http.StatusInternalServerError, err
 			}
 			if len(devices) != 1 {
 				log.Logger.Warn("Could not get device from device repo. Using default timezone")
@@ -321,7 +562,7 @@ func (this *impl) applyRulesForTable(table string, useDeleteTemplateInstead bool
 				}
 			}
 		} else {
-			return false, http.StatusBadRequest, errors.New("unknown table format")
+			return tableInfo, http.StatusBadRequest, errors.New("unknown table format")
 		}
 	}
 
@@ -329,7 +570,7 @@ func (this *impl) applyRulesForTable(table string, useDeleteTemplateInstead bool
 		realmRoleMappings, err := this.oidClient.GetRealmRoleMappings(userId)
 		if err != nil {
 			err = errors.New(err.Error() + ", userId: " + userId)
-			return false, http.StatusInternalServerError, err
+			return tableInfo, http.StatusInternalServerError, err
 		}
 		for _, realmRoleMapping := range realmRoleMappings {
 			if !slices.Contains(tableInfo.Roles, realmRoleMapping.Name) {
@@ -338,73 +579,48 @@ func (this *impl) applyRulesForTable(table string, useDeleteTemplateInstead bool
 		}
 	}
 
-	this.logDebug(table + " belongs to users " + strings.Join(tableInfo.UserIds, ", ") + " and roles " + strings.Join(tableInfo.Roles, ", "))
-	rules, err := this.db.FindMatchingRulesWithOwnerInfo(table, tableInfo.UserIds, tableInfo.Roles, limitToRuleIds, tx)
+	return tableInfo, http.StatusOK, nil
+}
+
+// ApplyAllRules applies all rules to all tables. The run is recorded as job, so that its progress is
+// reported like the progress of queued jobs and the job worker resumes it if this instance stops before finishing.
+func (this *impl) ApplyAllRules() error {
+	job, err := newJob(model.JobTypeApplyAll, "", "")
 	if err != nil {
-		return false, http.StatusInternalServerError, err
+		return err
 	}
-
-	if len(rules) > 0 {
-		tableInfo.Columns, err = this.db.GetColumns(table)
-		if err != nil {
-			return false, http.StatusInternalServerError, err
-		}
+	job.State = model.JobStateRunning
+	job.Started = &job.Created
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return err
 	}
-
-	for _, rule := range rules {
-		this.logDebug("applying rule " + rule.Id + " to table " + table)
-		t := rule.CommandTemplate
-		if useDeleteTemplateInstead {
-			t = rule.DeleteTemplate
-		}
-		savepoint := "rule"
-		_, err = tx.Exec("SAVEPOINT " + savepoint + ";")
-		if err != nil {
-			return false, http.StatusInternalServerError, err
-		}
-		errorhandling := func(ruleErr error) error {
-			allRanOk = false
-			_, err = tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint + ";")
-			if err != nil {
-				return err
-			}
-			if rule.Errors == nil {
-				rule.Errors = []string{}
-			}
-			rule.Errors = append(rule.Errors, table+": "+ruleErr.Error())
-			err = this.db.UpdateRule(&rule, tx)
-			return err
-		}
-		tmpl, err := template.New("").Parse(t)
-		if err != nil {
-			err = errorhandling(err)
-			if err != nil {
-				return false, http.StatusInternalServerError, err
-			}
-			continue
-		}
-		query, err := execTempl(tmpl, tableInfo)
-		if err != nil {
-			err = errorhandling(err)
-			if err != nil {
-				return false, http.StatusInternalServerError, err
-			}
-			continue
-		}
-		_, err = this.db.Exec(query, tx)
-		if err != nil {
-			err = errorhandling(err)
-			if err != nil {
-				return false, http.StatusInternalServerError, err
-			}
-			continue
-		}
+	defer cancel()
+	err = this.db.InsertJob(job, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
 	}
-
-	return allRanOk, http.StatusOK, nil
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	stopHeartbeat := this.startJobHeartbeat(job.Id)
+	err = this.applyAllRules(job)
+	stopHeartbeat()
+	this.finishJob(job, err)
+	return err
 }
 
-func (this *impl) ApplyAllRules() error {
+// applyAllRulesChunkSize is the number of tables after which the checkpoint of the job is saved.
+const applyAllRulesChunkSize = 100
+
+// applyAllRules applies all rules to all matching tables in order of the table names. Each table is changed in
+// a transaction of its own, tables of a chunk are processed concurrently, see forEachTable. After each chunk, the
+// progress and the last table of the chunk are saved as checkpoint of the job. Tables up to the checkpoint are
+// skipped, so a job continues where it stopped if it is run again. Tables that failed are saved as results of the job
+// and the job fails after all tables have been processed.
+func (this *impl) applyAllRules(job *model.Job) error {
 	err := this.lock()
 	if err != nil {
 		return err
@@ -414,124 +630,148 @@ func (this *impl) ApplyAllRules() error {
 		this.unlock()
 		this.logDebug("unlocked db for ApplyAllRules")
 	}()
-	limit := 1000
-	offset := 0
-	tx, cancel, err := this.db.GetTx()
+	tables, err := this.findMatchingTables(nil)
 	if err != nil {
 		return err
 	}
-	defer cancel()
-	for {
-		rules, _, err := this.ListRules(limit, offset)
-		if err != nil {
-			return err
-		}
-
-		ruleIds := make([]string, len(rules))
-		for i, rule := range rules {
-			ruleIds[i] = rule.Id
-		}
-		tables, err := this.db.FindMatchingTables(ruleIds, tx)
-		if err != nil {
-			return err
-		}
-
-		for _, table := range tables {
-			allOk, _, err := this.applyRulesForTable(table, false, ruleIds, tx)
+	done := 0
+	if len(job.Checkpoint) > 0 {
+		done = sort.Search(len(tables), func(i int) bool { return tables[i] > job.Checkpoint })
+		log.Logger.Info("resuming to apply all rules", "jobId", job.Id, "checkpoint", job.Checkpoint, "processed", done, "total", len(tables))
+	}
+	this.setJobProgress(job, done, len(tables))
+	if job.Results == nil {
+		job.Results = []model.TableResult{}
+	}
+	for start := done; start < len(tables); start += applyAllRulesChunkSize {
+		chunk := tables[start:min(start+applyAllRulesChunkSize, len(tables))]
+		failedMux := sync.Mutex{}
+		failed := []model.TableResult{}
+		_ = this.forEachTable(chunk, func(table string) error {
+			allOk, _, err := this.applyRulesForTableInTx(table, false, nil)
+			result := model.TableResult{Table: table, Action: model.TableActionApply}
 			if err != nil {
 				log.Logger.Error("could not apply rules to table", "table", table, attributes.ErrorKey, err)
-				continue
-			}
-			if !allOk {
+				result.Error = err.Error()
+			} else if !allOk {
 				log.Logger.Warn("Not all rules for table could be applied without errors", "table", table)
+				result.Error = "not all rules could be applied without errors, see the errors of the rules"
 			}
-		}
-
-		offset += len(rules)
-		if len(rules) < limit {
-			break
-		}
+			if len(result.Error) > 0 {
+				failedMux.Lock()
+				failed = append(failed, result)
+				failedMux.Unlock()
+			}
+			return nil
+		})
+		slices.SortFunc(failed, func(a, b model.TableResult) int { return strings.Compare(a.Table, b.Table) })
+		job.Results = append(job.Results, failed...)
+		job.Checkpoint = chunk[len(chunk)-1]
+		this.setJobProgress(job, start+len(chunk), len(tables))
+		log.Logger.Info("applying all rules", "jobId", job.Id, "processed", job.TablesProcessed, "total", job.TablesTotal, "failed", len(job.Results))
 	}
-	err = tx.Commit()
-	if err != nil {
-		return err
+	if len(job.Results) > 0 {
+		return errors.New("rules could not be applied to " + strconv.Itoa(len(job.Results)) + " tables")
 	}
 	return nil
 }
 
-func (this *impl) runRule(rule *model.Rule) {
-	this.logDebug("running rule " + rule.Id)
+// runRule applies the rule of the job to all matching tables. Each table is changed in a transaction of its own and
+// a table the rule failed on is rolled back, see forEachTableTx. With StrictOrdering, the tables are only changed if the
+// rule could be applied to every table. The errors are saved to the rule.
+func (this *impl) runRule(job *model.Job) error {
+	this.logDebug("running rule " + job.RuleId)
 	err := this.lock()
 	if err != nil {
-		log.Logger.Error("lock failed", attributes.ErrorKey, err)
-		return
+		return err
 	}
-	this.logDebug("locked db for rule " + rule.Id)
+	this.logDebug("locked db for rule " + job.RuleId)
 	defer func() {
 		this.unlock()
-		this.logDebug("unlocked db for rule " + rule.Id)
+		this.logDebug("unlocked db for rule " + job.RuleId)
 	}()
-	rule.Errors = []string{}
-	tx, cancel, err := this.db.GetTx()
-	defer cancel()
+	rule, err := this.resetRuleStatus(job.RuleId)
 	if err != nil {
-		log.Logger.Error("get tx failed", attributes.ErrorKey, err)
-		return
+		return err
+	}
+	tables, err := this.findMatchingTables([]string{rule.Id})
+	if err != nil {
+		return this.finishRuleRun(rule.Id, []error{err})
+	}
+	this.logDebug("for rule " + rule.Id + " found tables " + strings.Join(tables, ", "))
+	this.setJobProgress(job, 0, len(tables))
+
+	tx, cancel, err := this.getStrictTx()
+	if err != nil {
+		return err
 	}
-	rollbackAndSave := func(rule *model.Rule) {
-		log.Logger.Warn("rolling back rule", "ruleId", rule.Id, "errors", rule.Errors)
-		err = tx.Rollback()
+	defer cancel()
+	mux := sync.Mutex{}
+	processed := 0
+	errs := this.forEachTableTx(tables, tx, func(table string, tx *sql.Tx) error {
+		defer func() {
+			mux.Lock()
+			defer mux.Unlock()
+			processed++
+			this.setJobProgress(job, processed, len(tables))
+		}()
+		results, _, err := this.applyRules(table, false, []string{rule.Id}, false, tx)
 		if err != nil {
-			log.Logger.Error("tx rollback failed", attributes.ErrorKey, err)
+			return errors.New(table + ": " + err.Error())
 		}
-		err = this.saveRule(rule)
-		if err != nil {
-			log.Logger.Error("save rule failed", attributes.ErrorKey, err)
+		for _, result := range results {
+			if result.err != nil {
+				return errors.New(table + ": " + result.err.Error())
+			}
 		}
-	}
-	tables, err := this.db.FindMatchingTables([]string{rule.Id}, tx)
+		return nil
+	})
+	err = finishStrictTx(tx, errs)
 	if err != nil {
-		rule.Errors = append(rule.Errors, err.Error())
-		rollbackAndSave(rule)
-		return
+		errs = append(errs, err)
 	}
-	this.logDebug("for rule " + rule.Id + " found tables " + strings.Join(tables, ", "))
+	return this.finishRuleRun(rule.Id, errs)
+}
 
-	for _, table := range tables {
-		_, _, err := this.applyRulesForTable(table, false, []string{rule.Id}, tx)
+// resetRuleStatus clears the errors of the rule before it is run on its tables.
+// The status is committed immediately, so that the rule is not locked while tables are changed.
+func (this *impl) resetRuleStatus(id string) (rule *model.Rule, err error) {
+	err = this.inTx(func(tx *sql.Tx) error {
+		rule, err = this.db.GetRule(id, tx)
 		if err != nil {
-			rule.Errors = append(rule.Errors, err.Error())
-			rollbackAndSave(rule)
-			return
+			return err
 		}
-		rule, err = this.db.GetRule(rule.Id, tx)
+		rule.Errors = []string{}
+		rule.CompletedRun = false
+		return this.db.UpdateRuleStatus(rule, tx)
+	})
+	return rule, err
+}
+
+// finishRuleRun saves the errors of the tables a rule failed on to the rule and marks the run as completed if there
+// are none. Errors of failed tables are not saved by applyRules, as their transactions have been rolled back.
+func (this *impl) finishRuleRun(id string, errs []error) error {
+	rule := &model.Rule{}
+	err := this.inTx(func(tx *sql.Tx) (err error) {
+		rule, err = this.db.GetRule(id, tx)
 		if err != nil {
-			rule.Errors = append(rule.Errors, err.Error())
-			rollbackAndSave(rule)
-			return
+			return err
 		}
-		if rule.Errors != nil && len(rule.Errors) > 0 {
-			rollbackAndSave(rule)
-			return
+		for _, err := range errs {
+			rule.Errors = append(rule.Errors, err.Error())
 		}
-	}
-
-	this.logDebug("rule " + rule.Id + " finished run")
-	rule.CompletedRun = true
-	err = this.db.UpdateRule(rule, tx)
+		rule.CompletedRun = len(errs) == 0
+		return this.db.UpdateRuleStatus(rule, tx)
+	})
 	if err != nil {
-		log.Logger.Error("update rule failed", attributes.ErrorKey, err)
-		return
+		return err
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		log.Logger.Error("commit failed", attributes.ErrorKey, err)
-		return
+	if len(errs) > 0 {
+		log.Logger.Warn("rule finished with errors", "ruleId", id, "errors", rule.Errors)
+		return errors.New("rule finished with errors: " + strings.Join(rule.Errors, ", "))
 	}
-	this.logDebug("rule " + rule.Id + " finished run, committed changes")
-
-	return
+	this.logDebug("rule " + id + " finished run")
+	return nil
 }
 
 func (this *impl) saveRule(rule *model.Rule) error {
@@ -540,7 +780,7 @@ func (this *impl) saveRule(rule *model.Rule) error {
 	if err != nil {
 		return err
 	}
-	err = this.db.UpdateRule(rule, tx)
+	err = this.db.UpdateRuleStatus(rule, tx)
 	if err != nil {
 		return err
 	}
@@ -551,7 +791,12 @@ func (this *impl) saveRule(rule *model.Rule) error {
 	return nil
 }
 
+// lock serializes all operations changing tables in LockModeGlobal. In LockModeTable, it is a no-op and
+// operations only lock the tables they change, see applyRules.
 func (this *impl) lock() error {
+	if this.lockMode == config.LockModeTable {
+		return nil
+	}
 	time.Sleep(this.slowMuxLock)
 	this.mux.Lock()
 	this.logDebug("internal mux locked, attempting db mux lock")
@@ -566,6 +811,9 @@ func (this *impl) lock() error {
 }
 
 func (this *impl) unlock() {
+	if this.lockMode == config.LockModeTable {
+		return
+	}
 	err := this.db.Unlock()
 	if err != nil {
 		log.Logger.Error("unlocking db failed, panic will follow to avoid deadlock")
@@ -581,6 +829,30 @@ func (this *impl) logDebug(s string) {
 	}
 }
 
+// checkPolicy checks the rendered command or delete template of the rule against the SQL policy, if enabled.
+// Relations created by the command template of the rule count as created by the rule.
+func (this *impl) checkPolicy(rule model.Rule, query string, tableInfo model.TableInfo, isDelete bool) error {
+	if this.policy == nil {
+		return nil
+	}
+	var created []string
+	if isDelete {
+		command, err := renderTemplate(rule.CommandTemplate, tableInfo)
+		if err == nil {
+			created = policy.Created(command)
+		}
+	}
+	return this.policy.Check(query, tableInfo.Table, created)
+}
+
+func renderTemplate(t string, tableInfo model.TableInfo) (string, error) {
+	tmpl, err := templates.Parse(t)
+	if err != nil {
+		return "", err
+	}
+	return execTempl(tmpl, tableInfo)
+}
+
 func execTempl(t *template.Template, value any) (string, error) {
 	buf := &bytes.Buffer{}
 	err := t.Execute(buf, value)
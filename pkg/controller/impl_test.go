@@ -19,7 +19,10 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"reflect"
+	"regexp"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -63,16 +66,17 @@ func TestIntegration(t *testing.T) {
 		Errors:          []string{},
 	}
 	t.Run("Create", func(t *testing.T) {
-		_, _, err := c.CreateRule(rule)
+		_, _, err := c.CreateRule(rule, "")
 		if err == nil {
 			t.Fatal("was able to set id myself")
 		}
 		rule.Id = ""
-		typedRule, _, err := c.CreateRule(rule)
+		typedRule, _, err := c.CreateRule(rule, "")
 		if err != nil {
 			t.Fatal(err)
 		}
 		rule.Id = typedRule.Id
+		rule.Version = typedRule.Version
 		savedRule, _, err := c.GetRule(typedRule.Id)
 		if err != nil {
 			t.Fatal(err)
@@ -86,7 +90,7 @@ func TestIntegration(t *testing.T) {
 		}
 	})
 	t.Run("List", func(t *testing.T) {
-		list, _, err := c.ListRules(100, 0)
+		list, _, _, err := c.ListRules(model.RuleListOptions{Limit: 100})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -157,6 +161,163 @@ func TestIntegration(t *testing.T) {
 	})
 }
 
+func TestTemplates(t *testing.T) {
+	_, _, _, c, _, _, _, cleanup := setup(t)
+	defer cleanup()
+	tmpl := templates.Template{
+		Name:            "test",
+		CommandTemplate: "CREATE VIEW \"{{.Table}}_v\" AS SELECT 1;",
+		DeleteTemplate:  "DROP VIEW \"{{.Table}}_v\";",
+		Group:           "test",
+	}
+	t.Run("Create", func(t *testing.T) {
+		created, _, err := c.SetTemplate(tmpl, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.Version != 1 {
+			t.Fatal("unexpected version", created.Version)
+		}
+		tmpl = *created
+		_, code, err := c.SetTemplate(tmpl, true)
+		if err == nil || code != http.StatusConflict {
+			t.Fatal("expected conflict", code, err)
+		}
+	})
+	t.Run("Update", func(t *testing.T) {
+		tmpl.Description = "updated"
+		updated, _, err := c.SetTemplate(tmpl, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Version != 2 {
+			t.Fatal("version not incremented", updated.Version)
+		}
+		tmpl = *updated
+		saved, _, err := c.GetTemplate(tmpl.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*saved, tmpl) {
+			t.Fatal("Updated != Read")
+		}
+	})
+	t.Run("Persisted", func(t *testing.T) {
+		persisted, err := c.(*impl).db.GetTemplate(tmpl.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if persisted == nil || !reflect.DeepEqual(*persisted, tmpl) {
+			t.Fatal("template not persisted")
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		_, err := c.DeleteTemplate(tmpl.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, code, err := c.GetTemplate(tmpl.Name)
+		if err == nil || code != http.StatusNotFound {
+			t.Fatal("template not deleted")
+		}
+	})
+}
+
+func TestMigrateTemplateRules(t *testing.T) {
+	_, _, _, c, db, _, _, cleanup := setup(t)
+	defer cleanup()
+	tmpl, _, err := c.SetTemplate(templates.Template{
+		Name:            "migrate",
+		Group:           "migrate",
+		CommandTemplate: "SELECT 1;",
+		DeleteTemplate:  "SELECT 2;",
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like rules saved before the template was stored with the rule
+	rule := &model.Rule{
+		Id:              "migrate",
+		Group:           tmpl.Group,
+		TableRegEx:      "^userid:.{22}_export:.{22}$",
+		CommandTemplate: tmpl.CommandTemplate,
+		DeleteTemplate:  tmpl.DeleteTemplate,
+		Version:         1,
+	}
+	tx, cancel, err := db.GetTx()
+	defer cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.InsertRule(rule, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// instances migrate concurrently at startup
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			errs <- c.(*impl).migrateTemplateRules()
+		}()
+	}
+	for range 2 {
+		err = <-errs
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrated, _, err := c.GetTemplateRule(rule.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated.Template != tmpl.Name || migrated.Target != model.TemplateRuleTargetExport || migrated.TemplateVersion != tmpl.Version {
+		t.Errorf("template not stored %#v", migrated)
+	}
+	if migrated.Version != rule.Version {
+		t.Error("version changed", migrated.Version)
+	}
+}
+
+func TestConcurrentDependencyCycle(t *testing.T) {
+	_, _, _, c, _, _, _, cleanup := setup(t)
+	defer cleanup()
+	// the rules only introduce a cycle together
+	rules := []*model.Rule{
+		{Group: "a", DependsOn: []string{"b"}, TableRegEx: "^none$", CommandTemplate: "SELECT 1;"},
+		{Group: "b", DependsOn: []string{"a"}, TableRegEx: "^none$", CommandTemplate: "SELECT 1;"},
+	}
+	for range 10 {
+		errs := make(chan error, len(rules))
+		ids := make(chan string, len(rules))
+		for _, rule := range rules {
+			go func() {
+				typed, _, err := c.CreateRule(rule, "")
+				if err == nil {
+					ids <- typed.Id
+				}
+				errs <- err
+			}()
+		}
+		failed := 0
+		for range rules {
+			if <-errs != nil {
+				failed++
+			}
+		}
+		if failed != 1 {
+			t.Fatal("expected exactly one rule to be rejected, got", failed)
+		}
+		_, err := c.DeleteRule(<-ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestRuleLogicForDeviceTables(t *testing.T) {
 	_, _, _, c, db, permV2, deviceRepoDatabase, cleanup := setup(t)
 	i := c.(*impl)
@@ -306,7 +467,7 @@ func TestRuleLogicForDeviceTables(t *testing.T) {
 			DeleteTemplate: "DROP MATERIALIZED VIEW \"{{.Table}}_ld\";",
 		}
 
-		typedRule, _, err := c.CreateRule(&rule)
+		typedRule, _, err := c.CreateRule(&rule, "")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -331,6 +492,120 @@ func TestRuleLogicForDeviceTables(t *testing.T) {
 			}
 		})
 
+		t.Run("Preview", func(t *testing.T) {
+			preview, _, err := c.PreviewRule(&rule, "device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if preview.CommandError != "" || preview.DeleteError != "" {
+				t.Fatal(preview.CommandError, preview.DeleteError)
+			}
+			if preview.TableInfo.Timezone != "Asia/Kathmandu" {
+				t.Fatal("unexpected timezone " + preview.TableInfo.Timezone)
+			}
+			if preview.Delete != "DROP MATERIALIZED VIEW \"device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw_ld\";" {
+				t.Fatal("unexpected delete " + preview.Delete)
+			}
+		})
+
+		t.Run("Dry Run", func(t *testing.T) {
+			results, _, err := c.DryRunRule(typedRule.Id, model.DryRunRequest{Delete: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 2 {
+				t.Fatal("unexpected number of results")
+			}
+			for _, result := range results {
+				switch result.Table {
+				case "device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw":
+					if !result.Applied || !result.Success {
+						t.Fatal("expected successful dry run", result)
+					}
+				case "device:F_gsbPBvSb6xEz8lAWpguw_service:7IUxe2sUT32dRXAZhzXczw":
+					if result.Applied {
+						t.Fatal("rule should not apply to table of other user")
+					}
+				default:
+					t.Fatal("unexpected table " + result.Table)
+				}
+			}
+			columns, err := db.GetColumns("device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw_ld")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(columns) == 0 {
+				t.Fatal("dry run was not rolled back")
+			}
+		})
+
+		t.Run("Tables", func(t *testing.T) {
+			tables, _, err := c.GetRuleTables(typedRule.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tables) != 2 {
+				t.Fatal("unexpected number of tables")
+			}
+			for _, table := range tables {
+				switch table.Table {
+				case "device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw":
+					if !table.OwnerMatch || !table.WinsGroup || table.Status != model.RuleStatusApplied {
+						t.Fatal("expected rule to be applied", table)
+					}
+				case "device:F_gsbPBvSb6xEz8lAWpguw_service:7IUxe2sUT32dRXAZhzXczw":
+					if table.OwnerMatch || table.Status != model.RuleStatusExcluded {
+						t.Fatal("expected rule to be excluded", table)
+					}
+				default:
+					t.Fatal("unexpected table " + table.Table)
+				}
+			}
+		})
+
+		t.Run("Table Rules", func(t *testing.T) {
+			tableRules, _, err := c.GetTableRules("device:F_gsbPBvSb6xEz8lAWpguw_service:7IUxe2sUT32dRXAZhzXczw")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tableRules.TableInfo.Columns) == 0 {
+				t.Fatal("expected columns")
+			}
+			if len(tableRules.Rules) != 1 || tableRules.Rules[0].Id != typedRule.Id || tableRules.Rules[0].Status != model.RuleStatusExcluded {
+				t.Fatal("expected rule to be excluded", tableRules.Rules)
+			}
+		})
+
+		t.Run("Rerun", func(t *testing.T) {
+			job, _, err := c.RerunRule(typedRule.Id, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(2 * time.Second) // rule logic applied async
+			job, _, err = c.GetJob(job.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.State != model.JobStateSucceeded {
+				t.Fatal("unexpected job state "+job.State, job.Error)
+			}
+		})
+
+		t.Run("Apply Table", func(t *testing.T) {
+			job, _, err := c.QueueApplyAllRulesForTable("device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw", false, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(2 * time.Second) // rule logic applied async
+			job, _, err = c.GetJob(job.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.State != model.JobStateSucceeded || job.Table != "device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw" {
+				t.Fatal("unexpected job", job)
+			}
+		})
+
 		t.Run("Rule delete template executed for table correctly", func(t *testing.T) {
 			_, err = c.DeleteRule(typedRule.Id)
 			if err != nil {
@@ -440,7 +715,7 @@ func TestRuleLogicForExportTables(t *testing.T) {
 			DeleteTemplate: "DROP MATERIALIZED VIEW \"{{.Table}}_ld\";",
 		}
 
-		typedRule, _, err := c.CreateRule(&rule)
+		typedRule, _, err := c.CreateRule(&rule, "")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -518,7 +793,7 @@ func TestUpdateErrorHandling(t *testing.T) {
 		DeleteTemplate: "DROP MATERIALIZED VIEW \"{{.Table}}_ld\";",
 	}
 
-	typedRule, _, err := c.CreateRule(rule)
+	typedRule, _, err := c.CreateRule(rule, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -556,7 +831,7 @@ func TestUpdateErrorHandling(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = c.UpdateRule(typedRule.Rule)
+	_, _, err = c.UpdateRule(typedRule.Rule, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -576,13 +851,558 @@ func TestUpdateErrorHandling(t *testing.T) {
 				 {{range $i, $el := slice .Columns 1}}{{if $i}},{{end}} last({{.}}, time) AS {{.}}{{end}}
 				FROM "{{.Table}}"
 				GROUP BY 1 WITH NO DATA;`
-	_, err = c.UpdateRule(typedRule.Rule)
+	stale := typedRule.Rule.Copy()
+	_, _, err = c.UpdateRule(typedRule.Rule, "")
 	if err != nil {
 		t.Fatal(err)
 	}
+	_, code, err := c.UpdateRule(&stale, "")
+	if err == nil || code != http.StatusConflict {
+		t.Fatal("expected version conflict", code, err)
+	}
 	time.Sleep(2 * time.Second) // update still running in the background and panics if DB closes before it finishes
 }
 
+func TestUpdateRuleTables(t *testing.T) {
+	_, _, _, c, db, _, _, cleanup := setup(t)
+	defer cleanup()
+	i := c.(*impl)
+	users, err := i.oidClient.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId := ""
+	for _, user := range users {
+		if user.Username == "testuser" {
+			userId = user.Id
+		}
+	}
+	if len(userId) == 0 {
+		t.Fatal("testuser does not exist")
+	}
+	shortUserId, err := models.ShortenId(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableA := "userid:" + shortUserId + "_export:F_gsbPBvSb6xEz8lAWpguw"
+	tableB := "userid:" + shortUserId + "_export:7IUxe2sUT32dRXAZhzXczw"
+	tx, cancel, err := db.GetTx()
+	defer cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{tableA, tableB} {
+		_, err = db.Exec("CREATE TABLE IF NOT EXISTS \""+table+"\" (time TIMESTAMPTZ, val1 text, val2 integer);", tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viewExists := func(table string) bool {
+		columns, err := db.GetColumns(table + "_v")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(columns) > 0
+	}
+	update := func(rule *model.Rule, regex string) *model.Job {
+		rule.TableRegEx = regex
+		rule.Version = 0
+		typed, _, err := c.UpdateRule(rule, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return waitForJob(t, c, typed.JobId)
+	}
+	actions := func(job *model.Job) map[string]string {
+		result := map[string]string{}
+		for _, r := range job.Results {
+			if len(r.Error) > 0 {
+				t.Error(r.Table, r.Error)
+			}
+			result[r.Table] = r.Action
+		}
+		return result
+	}
+
+	rule := &model.Rule{
+		Group:           "g",
+		TableRegEx:      "userid.{23}_export:F_gsbPBvSb6xEz8lAWpguw",
+		Users:           []string{userId},
+		CommandTemplate: `CREATE OR REPLACE VIEW "{{.Table}}_v" AS SELECT * FROM "{{.Table}}";`,
+		DeleteTemplate:  `DROP VIEW "{{.Table}}_v";`,
+	}
+	typed, _, err := c.CreateRule(rule, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, c, typed.JobId)
+	rule = typed.Rule
+	if !viewExists(tableA) || viewExists(tableB) {
+		t.Fatal("rule not applied to matching table only")
+	}
+
+	t.Run("regex grows", func(t *testing.T) {
+		job := update(rule, "userid.{23}_export.{23}")
+		expected := map[string]string{tableA: model.TableActionApply, tableB: model.TableActionApply}
+		if got := actions(job); !reflect.DeepEqual(got, expected) {
+			t.Error("unexpected results", got)
+		}
+		if !viewExists(tableA) || !viewExists(tableB) {
+			t.Error("rule not applied to both tables")
+		}
+	})
+
+	t.Run("regex shrinks", func(t *testing.T) {
+		job := update(rule, "userid.{23}_export:F_gsbPBvSb6xEz8lAWpguw")
+		expected := map[string]string{tableA: model.TableActionApply, tableB: model.TableActionDelete}
+		if got := actions(job); !reflect.DeepEqual(got, expected) {
+			t.Error("unexpected results", got)
+		}
+		if !viewExists(tableA) || viewExists(tableB) {
+			t.Error("previous version not deleted from table that does not match anymore")
+		}
+	})
+
+	t.Run("regex shrinks without recorded applications", func(t *testing.T) {
+		// like rules applied before applications were recorded
+		tx, cancel, err := db.GetTx()
+		defer cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.DeleteApplication(rule.Id, tableA, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		job := update(rule, "userid.{23}_export:7IUxe2sUT32dRXAZhzXczw")
+		expected := map[string]string{tableA: model.TableActionDelete, tableB: model.TableActionApply}
+		if got := actions(job); !reflect.DeepEqual(got, expected) {
+			t.Error("unexpected results", got)
+		}
+		if viewExists(tableA) || !viewExists(tableB) {
+			t.Error("previous version not deleted from table that does not match anymore")
+		}
+	})
+}
+
+func TestUpgradeTemplateRules(t *testing.T) {
+	_, _, _, c, db, _, _, cleanup := setup(t)
+	defer cleanup()
+	i := c.(*impl)
+	users, err := i.oidClient.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId := ""
+	for _, user := range users {
+		if user.Username == "testuser" {
+			userId = user.Id
+		}
+	}
+	if len(userId) == 0 {
+		t.Fatal("testuser does not exist")
+	}
+	shortUserId, err := models.ShortenId(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := "userid:" + shortUserId + "_export:7IUxe2sUT32dRXAZhzXczw"
+	tx, cancel, err := db.GetTx()
+	defer cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS \""+table+"\" (time TIMESTAMPTZ, val1 text, val2 integer);", tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewHasColumn := func(column string) bool {
+		columns, err := db.GetColumns(table + "_v")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return slices.Contains(columns, column)
+	}
+
+	tmpl := templates.Template{
+		Name:            "upgrade",
+		Group:           "upgrade",
+		CommandTemplate: `CREATE OR REPLACE VIEW "{{.Table}}_v" AS SELECT time FROM "{{.Table}}" LIMIT {{.Params.limit}};`,
+		DeleteTemplate:  `DROP VIEW IF EXISTS "{{.Table}}_v";`,
+		Parameters:      []templates.Parameter{{Name: "limit", Type: templates.ParameterTypeInteger, Default: float64(10)}},
+	}
+	_, _, err = c.SetTemplate(tmpl, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := (&model.TemplateRule{Target: model.TemplateRuleTargetExport, Users: []string{userId}, Template: tmpl.Name,
+		Parameters: map[string]any{"limit": float64(5)}}).Rule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed, _, err := c.CreateRule(rule, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, c, typed.JobId)
+	if !viewHasColumn("time") || viewHasColumn("val1") {
+		t.Fatal("rule not applied")
+	}
+
+	t.Run("upgrade", func(t *testing.T) {
+		tmpl.CommandTemplate = `CREATE OR REPLACE VIEW "{{.Table}}_v" AS SELECT time, val1 FROM "{{.Table}}" LIMIT {{.Params.limit}};`
+		updated, _, err := c.SetTemplate(tmpl, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Version != 2 {
+			t.Fatal("version not incremented", updated.Version)
+		}
+		outdated, _, err := c.ListOutdatedTemplateRules(tmpl.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outdated) != 1 || outdated[0].Id != typed.Id {
+			t.Fatal("unexpected outdated rules", outdated)
+		}
+		job, _, err := c.UpgradeTemplateRules(tmpl.Name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForJob(t, c, job.Id)
+		upgraded, _, err := c.GetTemplateRule(typed.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if upgraded.TemplateVersion != 2 || len(upgraded.Errors) > 0 {
+			t.Errorf("rule not upgraded %#v", upgraded)
+		}
+		if !viewHasColumn("val1") {
+			t.Error("upgraded command not applied")
+		}
+		outdated, _, err = c.ListOutdatedTemplateRules(tmpl.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outdated) != 0 {
+			t.Error("upgraded rule still outdated", outdated)
+		}
+	})
+
+	t.Run("failed upgrade keeps version", func(t *testing.T) {
+		tmpl.CommandTemplate = `SELECT * FROM "does not exist" LIMIT {{.Params.limit}};`
+		_, _, err := c.SetTemplate(tmpl, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, err := newJob(model.JobTypeUpgradeTemplate, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.Template = tmpl.Name
+		tx, cancel, err := db.GetTx()
+		defer cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.InsertJob(job, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = i.upgradeTemplateRules(job)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		failed, _, err := c.GetTemplateRule(typed.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.TemplateVersion != 2 || len(failed.Errors) == 0 {
+			t.Errorf("unexpected rule after failed upgrade %#v", failed)
+		}
+		if !viewHasColumn("val1") {
+			t.Error("failed upgrade not rolled back")
+		}
+	})
+}
+
+func TestApplyAllRulesResume(t *testing.T) {
+	_, _, _, c, db, _, _, cleanup := setup(t)
+	defer cleanup()
+	i := c.(*impl)
+	users, err := i.oidClient.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId := ""
+	for _, user := range users {
+		if user.Username == "testuser" {
+			userId = user.Id
+		}
+	}
+	if len(userId) == 0 {
+		t.Fatal("testuser does not exist")
+	}
+	shortUserId, err := models.ShortenId(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableA := "userid:" + shortUserId + "_export:7IUxe2sUT32dRXAZhzXczw"
+	tableB := "userid:" + shortUserId + "_export:F_gsbPBvSb6xEz8lAWpguw"
+	// rules are saved without queueing a job, so that they are only applied by applyAllRules
+	insert := func(rule *model.Rule) {
+		tx, cancel, err := db.GetTx()
+		defer cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{tableA, tableB} {
+			_, err = db.Exec("CREATE TABLE IF NOT EXISTS \""+table+"\" (time TIMESTAMPTZ, val1 text, val2 integer);", tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = db.InsertRule(rule, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	viewExists := func(table string) bool {
+		columns, err := db.GetColumns(table + "_v")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(columns) > 0
+	}
+	newApplyAllJob := func(checkpoint string) *model.Job {
+		job, err := newJob(model.JobTypeApplyAll, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.Checkpoint = checkpoint
+		tx, cancel, err := db.GetTx()
+		defer cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.InsertJob(job, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+
+	insert(&model.Rule{
+		Id:              "resume",
+		Group:           "g",
+		TableRegEx:      "userid.{23}_export.{23}",
+		Users:           []string{userId},
+		CommandTemplate: `CREATE OR REPLACE VIEW "{{.Table}}_v" AS SELECT * FROM "{{.Table}}";`,
+		DeleteTemplate:  `DROP VIEW IF EXISTS "{{.Table}}_v";`,
+		Version:         1,
+	})
+
+	t.Run("resume after checkpoint", func(t *testing.T) {
+		job := newApplyAllJob(tableA)
+		err := i.applyAllRules(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if viewExists(tableA) {
+			t.Error("table up to the checkpoint not skipped")
+		}
+		if !viewExists(tableB) {
+			t.Error("table after the checkpoint not processed")
+		}
+		saved, _, err := c.GetJob(job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Checkpoint != tableB || saved.TablesProcessed != 2 || saved.TablesTotal != 2 {
+			t.Errorf("unexpected progress %#v", saved)
+		}
+	})
+
+	t.Run("failed tables", func(t *testing.T) {
+		insert(&model.Rule{
+			Id:              "failing",
+			Group:           "h",
+			TableRegEx:      "userid.{23}_export:F_gsbPBvSb6xEz8lAWpguw",
+			Users:           []string{userId},
+			CommandTemplate: `SELECT * FROM "does not exist";`,
+			Version:         1,
+		})
+		job := newApplyAllJob("")
+		err := i.applyAllRules(job)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if len(job.Results) != 1 || job.Results[0].Table != tableB || len(job.Results[0].Error) == 0 {
+			t.Errorf("unexpected results %#v", job.Results)
+		}
+		if !viewExists(tableA) {
+			t.Error("table without failing rules not processed")
+		}
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	_, _, _, c, db, _, _, cleanup := setup(t)
+	defer cleanup()
+	i := c.(*impl)
+	users, err := i.oidClient.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId := ""
+	for _, user := range users {
+		if user.Username == "testuser" {
+			userId = user.Id
+		}
+	}
+	if len(userId) == 0 {
+		t.Fatal("testuser does not exist")
+	}
+	shortUserId, err := models.ShortenId(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := "userid:" + shortUserId + "_export:F_gsbPBvSb6xEz8lAWpguw"
+	exec := func(query string) {
+		tx, cancel, err := db.GetTx()
+		defer cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(query, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("CREATE TABLE IF NOT EXISTS \"" + table + "\" (time TIMESTAMPTZ, val1 text, val2 integer);")
+
+	_, code, _ := c.GetDriftReport()
+	if code != http.StatusNotFound {
+		t.Fatal("expected no report", code)
+	}
+	typed, _, err := c.CreateRule(&model.Rule{
+		Group:           "g",
+		TableRegEx:      "userid.{23}_export:F_gsbPBvSb6xEz8lAWpguw",
+		Users:           []string{userId},
+		CommandTemplate: `CREATE OR REPLACE VIEW "{{.Table}}_v" AS SELECT * FROM "{{.Table}}";`,
+		DeleteTemplate:  `DROP VIEW IF EXISTS "{{.Table}}_v";`,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, c, typed.JobId)
+
+	t.Run("no drift", func(t *testing.T) {
+		report, err := i.reconcile(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.TablesChecked != 1 || len(report.Drift) != 0 || len(report.Reapplied) != 0 {
+			t.Errorf("unexpected report %#v", report)
+		}
+	})
+
+	exec("DROP VIEW \"" + table + "_v\";")
+	t.Run("drift reported", func(t *testing.T) {
+		report, err := i.reconcile(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Drift) != 1 || report.Drift[0].Kind != model.DriftKindObjectsMissing || report.Drift[0].Table != table || len(report.Reapplied) != 0 {
+			t.Errorf("unexpected report %#v", report)
+		}
+		saved, _, err := c.GetDriftReport()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved.Drift) != 1 || saved.Finished.Sub(report.Finished).Abs() > time.Millisecond {
+			t.Errorf("unexpected saved report %#v", saved)
+		}
+	})
+
+	t.Run("reconciliation running on another instance", func(t *testing.T) {
+		unlock, ok, err := db.TryLockReconciler()
+		if err != nil || !ok {
+			t.Fatal("could not lock", err)
+		}
+		report, err := i.reconcile(true)
+		unlock()
+		if err != nil || report != nil {
+			t.Error("expected skipped run", report, err)
+		}
+	})
+
+	t.Run("drift applied again", func(t *testing.T) {
+		report, err := i.reconcile(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Reapplied) != 1 || report.Reapplied[0] != table {
+			t.Errorf("unexpected report %#v", report)
+		}
+		columns, err := db.GetColumns(table + "_v")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(columns) == 0 {
+			t.Error("view not created again")
+		}
+	})
+}
+
+// waitForJob waits until the job finished and fails the test if it did not succeed.
+func waitForJob(t *testing.T, c Controller, id string) *model.Job {
+	for range 100 {
+		job, _, err := c.GetJob(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch job.State {
+		case model.JobStateSucceeded:
+			return job
+		case model.JobStateFailed:
+			t.Fatal("job failed", job.Error)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("job did not finish")
+	return nil
+}
+
 func setup(t *testing.T) (ctx context.Context, wg *sync.WaitGroup, conf config.Config, c Controller, db database.DB, permV2 *permCtrl.Controller, deviceRepoDatabase deviceRepoDB.Database, cleanup func()) {
 	log.InitForTest()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -634,12 +1454,16 @@ func setup(t *testing.T) (ctx context.Context, wg *sync.WaitGroup, conf config.C
 		DefaultTimezone:             "Europe/Berlin",
 	}
 	config.HandleEnvironmentVars(&conf)
-	templates.New(&conf)
+	ts, _ := templates.New(&conf)
 	t.Run("Setup DB", func(t *testing.T) {
 		db, err = database.New(conf.PostgresHost, conf.PostgresPort, conf.PostgresUser, conf.PostgresPw, conf.PostgresDb, conf.PostgresRuleSchema, conf.PostgresRuleTable, conf.Timeout, conf.PostgresLockKey, conf.Debug, ctx, wg)
 		if err != nil {
 			t.Fatal(err)
 		}
+		err = ts.UsePersistence(db, ctx, wg)
+		if err != nil {
+			t.Fatal(err)
+		}
 	})
 
 	t.Run("Test Dependency Connection", func(t *testing.T) {
@@ -674,3 +1498,62 @@ func TestShortIds(t *testing.T) {
 	}
 	fmt.Println(long + " <-> " + short)
 }
+
+func TestValidateRule(t *testing.T) {
+	rule := model.Rule{
+		TableRegEx:      "device.{23}_service.{23}",
+		CommandTemplate: "CREATE VIEW \"{{.Table}}_v\" AS SELECT 1;",
+		DeleteTemplate:  "DROP VIEW \"{{.Table}}_v\";",
+	}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	invalid := rule
+	invalid.TableRegEx = "device("
+	if validateRule(invalid) == nil {
+		t.Fatal("expected invalid table_reg_ex")
+	}
+	invalid = rule
+	invalid.DeleteTemplate = "DROP VIEW \"{{.Table}_v\";"
+	if validateRule(invalid) == nil {
+		t.Fatal("expected invalid delete_template")
+	}
+}
+
+func TestTableMatch(t *testing.T) {
+	for table, expected := range map[string]*regexp.Regexp{
+		"userid:7IUxe2sUT32dRXAZhzXczw_export:F_gsbPBvSb6xEz8lAWpguw":     exportTableMatch,
+		"userid:7IUxe2sUT32dRXAZhzXczw_export:F_gsbPBvSb6xEz8lAWpguw_v":   exportTableMatch,
+		"device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw":    deviceTableMatch,
+		"device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw_ld": deviceTableMatch,
+		"x_userid:7IUxe2sUT32dRXAZhzXczw_export:F_gsbPBvSb6xEz8lAWpguw":   nil,
+		"device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguwx":   nil,
+		"device:7IUxe2sUT32dRXAZ'zXczw_service:F_gsbPBvSb6xEz8lAWpguw":    nil,
+	} {
+		for _, match := range []*regexp.Regexp{exportTableMatch, deviceTableMatch} {
+			if match.MatchString(table) != (match == expected) {
+				t.Error("unexpected match", table, match)
+			}
+		}
+	}
+}
+
+func TestWinsGroup(t *testing.T) {
+	tableInfo := model.TableInfo{Table: "t", UserIds: []string{"u"}, Roles: []string{}}
+	previous := model.Rule{Id: "a", Group: "g", Priority: 1, Users: []string{"u"}}
+	candidates := []model.Rule{
+		{Id: "a", Group: "g", Priority: 10, Users: []string{"u"}},
+		{Id: "b", Group: "g", Priority: 5, Users: []string{"u"}},
+		{Id: "c", Group: "g", Priority: 20, Users: []string{"other"}},
+		{Id: "d", Group: "h", Priority: 20, Users: []string{"u"}},
+	}
+	if winsGroup(previous, tableInfo, candidates) {
+		t.Error("previous version shadowed by b expected")
+	}
+	if !winsGroup(candidates[0], tableInfo, candidates) {
+		t.Error("current version expected to win its group")
+	}
+	if winsGroup(model.Rule{Id: "e", Group: "g", Priority: 30, Users: []string{"other"}}, tableInfo, candidates) {
+		t.Error("rule of other owner expected to be excluded")
+	}
+}
@@ -18,14 +18,40 @@ package controller
 
 import (
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
 )
 
 type Controller interface {
-	CreateRule(rule *model.Rule) (res *model.TypedRule, code int, err error)
-	UpdateRule(rule *model.Rule) (code int, err error)
+	CreateRule(rule *model.Rule, requestId string) (res *model.TypedRule, code int, err error)
+	UpdateRule(rule *model.Rule, requestId string) (res *model.TypedRule, code int, err error)
 	DeleteRule(id string) (code int, err error)
 	GetRule(id string) (rule *model.TypedRule, code int, err error)
-	ListRules(limit, offset int) (rules []model.TypedRule, code int, err error)
+	ListRules(options model.RuleListOptions) (rules []model.TypedRule, total int, code int, err error)
+	ListTemplateRules(options model.RuleListOptions) (templateRules []model.TemplateRule, total int, code int, err error)
+	GetTemplateRule(id string) (templateRule *model.TemplateRule, code int, err error)
+	PreviewRule(rule *model.Rule, table string) (preview *model.RulePreview, code int, err error)
+	DryRunRule(id string, request model.DryRunRequest) (results []model.DryRunResult, code int, err error)
+	GetRuleTables(id string) (tables []model.RuleTable, code int, err error)
+	GetTableRules(table string) (tableRules *model.TableRules, code int, err error)
+	ListRuleApplications(id string) (applications []model.RuleApplication, code int, err error)
+	ListTableApplications(table string) (applications []model.RuleApplication, code int, err error)
+	GetDriftReport() (report *model.DriftReport, code int, err error)
+	ExportRules(bundle *model.RuleBundleWriter) (code int, err error)
+	ImportRules(bundle model.RuleBundle, options model.RuleImportOptions, requestId string) (report *model.RuleImportReport, code int, err error)
+
+	ListTemplates() (list map[string]templates.TemplateInfo, code int, err error)
+	ListTemplateRuleTargets() (targets []templates.Target, code int, err error)
+	GetTemplate(name string) (tmpl *templates.Template, code int, err error)
+	SetTemplate(tmpl templates.Template, create bool) (result *templates.Template, code int, err error)
+	DeleteTemplate(name string) (code int, err error)
+	ListOutdatedTemplateRules(name string) (templateRules []model.TemplateRule, code int, err error)
+	UpgradeTemplateRules(name string, requestId string) (job *model.Job, code int, err error)
+
+	GetJob(id string) (job *model.Job, code int, err error)
+	ListJobs(limit, offset int) (jobs []model.Job, code int, err error)
+	RerunRule(id string, requestId string) (job *model.Job, code int, err error)
+	QueueApplyAllRulesForTable(table string, useDeleteTemplateInstead bool, requestId string) (job *model.Job, code int, err error)
+	QueueApplyAllRules(requestId string) (job *model.Job, code int, err error)
 
 	ApplyAllRules() (err error)
 	ApplyAllRulesForTable(table string, useDeleteTemplateInstead bool) (code int, err error)
@@ -0,0 +1,289 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/go-service-base/struct-logger/attributes"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/hashicorp/go-uuid"
+)
+
+const jobPollInterval = 10 * time.Second
+const jobHeartbeatInterval = 10 * time.Second
+const jobStaleAfter = 6 * jobHeartbeatInterval
+
+func (this *impl) GetJob(id string) (job *model.Job, code int, err error) {
+	job, err = this.db.GetJob(id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	return job, http.StatusOK, nil
+}
+
+func (this *impl) ListJobs(limit, offset int) (jobs []model.Job, code int, err error) {
+	jobs, err = this.db.ListJobs(limit, offset)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return jobs, http.StatusOK, nil
+}
+
+// RerunRule clears the errors of the rule with the given id and queues a job applying it to all matching tables again.
+func (this *impl) RerunRule(id string, requestId string) (job *model.Job, code int, err error) {
+	job, err = newJob(model.JobTypeRunRule, id, requestId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	rule, err := this.db.GetRule(id, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	rule.Errors = []string{}
+	rule.CompletedRun = false
+	err = this.db.UpdateRuleStatus(rule, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, http.StatusInternalServerError, err
+	}
+	return this.queueJob(job, tx)
+}
+
+// QueueApplyAllRulesForTable queues a job running ApplyAllRulesForTable.
+func (this *impl) QueueApplyAllRulesForTable(table string, useDeleteTemplateInstead bool, requestId string) (job *model.Job, code int, err error) {
+	_, code, err = this.getColumns(table)
+	if err != nil {
+		return nil, code, err
+	}
+	job, err = newJob(model.JobTypeApplyTable, "", requestId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	job.Table = table
+	job.Delete = useDeleteTemplateInstead
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	return this.queueJob(job, tx)
+}
+
+// QueueApplyAllRules queues a job running ApplyAllRules.
+func (this *impl) QueueApplyAllRules(requestId string) (job *model.Job, code int, err error) {
+	job, err = newJob(model.JobTypeApplyAll, "", requestId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	return this.queueJob(job, tx)
+}
+
+// queueJob inserts the job, commits tx and notifies the job worker.
+func (this *impl) queueJob(job *model.Job, tx *sql.Tx) (*model.Job, int, error) {
+	err := this.db.InsertJob(job, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, http.StatusInternalServerError, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	this.notifyJobWorker()
+	return job, http.StatusOK, nil
+}
+
+func newJob(jobType model.JobType, ruleId string, requestId string) (*model.Job, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &model.Job{
+		Id:        id,
+		Type:      jobType,
+		RuleId:    ruleId,
+		State:     model.JobStateQueued,
+		Created:   now,
+		Updated:   now,
+		RequestId: requestId,
+	}, nil
+}
+
+// startJobWorker runs queued jobs, up to JobConcurrency at the same time. Jobs are picked up immediately after
+// notifyJobWorker was called and periodically, to also run jobs created by other instances or left behind by stopped
+// instances. Jobs of the same rule run one after another, see database.DB.ClaimNextJob.
+func (this *impl) startJobWorker(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(jobPollInterval)
+		defer ticker.Stop()
+		for {
+			requeued, err := this.db.RequeueStaleJobs(jobStaleAfter)
+			if err != nil {
+				log.Logger.Error("could not requeue stale jobs", attributes.ErrorKey, err)
+			} else if requeued > 0 {
+				log.Logger.Info("requeued stale jobs", "count", requeued)
+			}
+			this.runQueuedJobs(ctx, wg)
+			select {
+			case <-ctx.Done():
+				return
+			case <-this.jobNotify:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (this *impl) notifyJobWorker() {
+	select {
+	case this.jobNotify <- struct{}{}:
+	default: // worker is already notified
+	}
+}
+
+// runQueuedJobs claims queued jobs while a job slot is free and runs each of them in a goroutine of its own.
+func (this *impl) runQueuedJobs(ctx context.Context, wg *sync.WaitGroup) {
+	for ctx.Err() == nil {
+		select {
+		case this.jobSlots <- struct{}{}:
+		default:
+			return // all slots are busy, the worker is notified when a job finished
+		}
+		job, err := this.db.ClaimNextJob()
+		if err != nil {
+			<-this.jobSlots
+			if !errors.Is(err, database.ErrNotFound) {
+				log.Logger.Error("could not claim job", attributes.ErrorKey, err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				<-this.jobSlots
+				this.notifyJobWorker()
+			}()
+			log.Logger.Info("running job", "jobId", job.Id, "type", job.Type, "ruleId", job.RuleId)
+			stopHeartbeat := this.startJobHeartbeat(job.Id)
+			err := this.runJob(job)
+			stopHeartbeat()
+			if ctx.Err() != nil {
+				// job was interrupted by shutdown and will be requeued once its heartbeat is stale
+				return
+			}
+			this.finishJob(job, err)
+		}()
+	}
+}
+
+func (this *impl) runJob(job *model.Job) error {
+	switch job.Type {
+	case model.JobTypeRunRule:
+		return this.runRule(job)
+	case model.JobTypeApplyTable:
+		_, err := this.ApplyAllRulesForTable(job.Table, job.Delete)
+		return err
+	case model.JobTypeApplyAll:
+		return this.applyAllRules(job)
+	case model.JobTypeUpgradeTemplate:
+		return this.upgradeTemplateRules(job)
+	case model.JobTypeUpdateRule:
+		return this.updateRule(job)
+	default:
+		return errors.New("unknown job type " + job.Type)
+	}
+}
+
+func (this *impl) startJobHeartbeat(id string) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := this.db.TouchJob(id)
+				if err != nil {
+					log.Logger.Warn("could not update job heartbeat", "jobId", id, attributes.ErrorKey, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func (this *impl) setJobProgress(job *model.Job, processed int, total int) {
+	job.TablesProcessed = processed
+	job.TablesTotal = total
+	job.Updated = time.Now()
+	err := this.db.UpdateJob(job)
+	if err != nil {
+		log.Logger.Warn("could not update job progress", "jobId", job.Id, attributes.ErrorKey, err)
+	}
+}
+
+func (this *impl) finishJob(job *model.Job, jobErr error) {
+	now := time.Now()
+	job.Ended = &now
+	job.Updated = now
+	if jobErr != nil {
+		log.Logger.Warn("job failed", "jobId", job.Id, attributes.ErrorKey, jobErr)
+		job.State = model.JobStateFailed
+		job.Error = jobErr.Error()
+	} else {
+		log.Logger.Info("job succeeded", "jobId", job.Id)
+		job.State = model.JobStateSucceeded
+		job.Error = ""
+	}
+	err := this.db.UpdateJob(job)
+	if err != nil {
+		log.Logger.Error("could not save finished job", "jobId", job.Id, attributes.ErrorKey, err)
+	}
+}
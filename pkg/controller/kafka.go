@@ -41,6 +41,8 @@ type DeviceCommand struct {
 	Id      string `json:"id"`
 }
 
+// kafkaMessageHandler applies all rules to the tables of the message. Each table is changed in a transaction
+// of its own, see forEachTable.
 func (this *impl) kafkaMessageHandler(topic string, msg []byte, _ time.Time) error {
 	err := this.lock()
 	if err != nil {
@@ -51,11 +53,7 @@ func (this *impl) kafkaMessageHandler(topic string, msg []byte, _ time.Time) err
 		this.unlock()
 		this.logDebug("unlocked db for kafkaMessageHandler on topic " + topic + " with message " + string(msg))
 	}()
-	tx, cancel, err := this.db.GetTx()
-	defer cancel()
-	if err != nil {
-		return err
-	}
+	var tables []string
 	switch topic {
 	case this.kafkaTopicPermissionUpdates:
 		var message DeviceCommand
@@ -66,16 +64,10 @@ func (this *impl) kafkaMessageHandler(topic string, msg []byte, _ time.Time) err
 		if message.Command == "DELETE" {
 			return nil
 		}
-		tables, err := this.db.FindDeviceTables(message.Id)
+		tables, err = this.db.FindDeviceTables(message.Id)
 		if err != nil {
 			return err
 		}
-		for _, table := range tables {
-			_, _, err = this.applyRulesForTable(table, false, nil, tx)
-			if err != nil {
-				return err
-			}
-		}
 	case this.kafkaTopicTableUpdates:
 		var message model.TableEditMessage
 		err := json.Unmarshal(msg, &message)
@@ -85,20 +77,14 @@ func (this *impl) kafkaMessageHandler(topic string, msg []byte, _ time.Time) err
 		if message.Method == model.TableEditMessageMethodDelete {
 			return nil
 		}
-		for _, table := range message.Tables {
-			_, _, err = this.applyRulesForTable(table, false, nil, tx)
-			if err != nil {
-				return err
-			}
-		}
+		tables = message.Tables
 	default:
 		return errors.New("got kafka message on unexpected topic")
 	}
-	err = tx.Commit()
-	if err != nil {
+	return this.forEachTable(tables, func(table string) error {
+		_, _, err := this.applyRulesForTableInTx(table, false, nil)
 		return err
-	}
-	return nil
+	})
 }
 
 func (this *impl) kafkaErrorHandler(err error, consumer *kafka.Consumer) {
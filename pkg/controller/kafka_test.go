@@ -170,7 +170,7 @@ func TestKafkaUpdateBehaviour(t *testing.T) {
 			DeleteTemplate: "DROP MATERIALIZED VIEW \"{{.Table}}_ld\";",
 		}
 
-		_, _, err = c.CreateRule(&rule)
+		_, _, err = c.CreateRule(&rule, "")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -258,7 +258,7 @@ func TestKafkaUpdateBehaviour(t *testing.T) {
 			DeleteTemplate: "DROP MATERIALIZED VIEW \"{{.Table}}_ld\";",
 		}
 
-		_, _, err = c.CreateRule(&rule)
+		_, _, err = c.CreateRule(&rule, "")
 		if err != nil {
 			t.Fatal(err)
 		}
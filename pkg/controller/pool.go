@@ -0,0 +1,142 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// forEachTable calls f for each table. Calls for different tables run concurrently, but the number of
+// concurrent calls is bounded by the ApplyConcurrency across all operations of the controller.
+// f may not call forEachTable itself. Returns the errors of all calls.
+func (this *impl) forEachTable(tables []string, f func(table string) error) error {
+	queue := make(chan string)
+	go func() {
+		defer close(queue)
+		for _, table := range tables {
+			queue <- table
+		}
+	}()
+	mux := sync.Mutex{}
+	errs := []error{}
+	wg := sync.WaitGroup{}
+	for range min(cap(this.tableSlots), len(tables)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for table := range queue {
+				this.tableSlots <- struct{}{}
+				err := f(table)
+				<-this.tableSlots
+				if err != nil {
+					mux.Lock()
+					errs = append(errs, err)
+					mux.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// applyRulesForTableInTx applies the rules to the table in a transaction of its own.
+func (this *impl) applyRulesForTableInTx(table string, useDeleteTemplateInstead bool, limitToRuleIds []string) (allRanOk bool, code int, err error) {
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return false, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	allRanOk, code, err = this.applyRulesForTable(table, useDeleteTemplateInstead, limitToRuleIds, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, code, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, http.StatusInternalServerError, err
+	}
+	return allRanOk, code, nil
+}
+
+// forEachTableTx calls f for each table. If tx is nil, each table is changed in a transaction of its own, which is
+// only committed if f succeeded, and tables are processed concurrently, see forEachTable. Otherwise, all tables are
+// changed in tx one after another in the given order, stopping at the first table f fails for. The caller has to
+// commit or roll back tx, see getStrictTx. Returns the errors of f.
+func (this *impl) forEachTableTx(tables []string, tx *sql.Tx, f func(table string, tx *sql.Tx) error) (errs []error) {
+	if tx != nil {
+		for _, table := range tables {
+			err := f(table, tx)
+			if err != nil {
+				return []error{err}
+			}
+		}
+		return nil
+	}
+	mux := sync.Mutex{}
+	_ = this.forEachTable(tables, func(table string) error {
+		err := this.inTx(func(tx *sql.Tx) error {
+			return f(table, tx)
+		})
+		if err != nil {
+			mux.Lock()
+			errs = append(errs, err)
+			mux.Unlock()
+		}
+		return nil
+	})
+	return errs
+}
+
+// inTx calls f in a new transaction, which is committed if f succeeded and rolled back otherwise.
+func (this *impl) inTx(f func(tx *sql.Tx) error) error {
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	err = f(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// getStrictTx returns the transaction all tables of a rule are changed in if StrictOrdering is configured and nil
+// otherwise, see forEachTableTx.
+func (this *impl) getStrictTx() (tx *sql.Tx, cancel context.CancelFunc, err error) {
+	if !this.strictOrdering {
+		return nil, func() {}, nil
+	}
+	return this.db.GetTx()
+}
+
+// finishStrictTx commits tx if no table failed and rolls it back otherwise. tx may be nil, see getStrictTx.
+func finishStrictTx(tx *sql.Tx, errs []error) error {
+	if tx == nil {
+		return nil
+	}
+	if len(errs) > 0 {
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachTable(t *testing.T) {
+	control := &impl{tableSlots: make(chan struct{}, 3)}
+	tables := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	var running, maxRunning atomic.Int32
+	mux := sync.Mutex{}
+	done := []string{}
+	err := control.forEachTable(tables, func(table string) error {
+		current := running.Add(1)
+		for {
+			m := maxRunning.Load()
+			if current <= m || maxRunning.CompareAndSwap(m, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		mux.Lock()
+		done = append(done, table)
+		mux.Unlock()
+		if table == "c" || table == "f" {
+			return errors.New("failed " + table)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "failed c\nfailed f" && err.Error() != "failed f\nfailed c" {
+		t.Error("expected errors of c and f, got", err)
+	}
+	slices.Sort(done)
+	if !slices.Equal(done, tables) {
+		t.Error("not all tables processed", done)
+	}
+	if maxRunning.Load() > 3 {
+		t.Error("concurrency not bounded", maxRunning.Load())
+	}
+	if maxRunning.Load() < 2 {
+		t.Error("tables not processed concurrently")
+	}
+
+	err = control.forEachTable(nil, func(table string) error {
+		t.Error("unexpected call")
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestForEachTableTxStrict(t *testing.T) {
+	control := &impl{tableSlots: make(chan struct{}, 3)}
+	tx := &sql.Tx{}
+	done := []string{}
+	errs := control.forEachTableTx([]string{"a", "b", "c", "d"}, tx, func(table string, fTx *sql.Tx) error {
+		if fTx != tx {
+			t.Error("table not changed in the given transaction")
+		}
+		done = append(done, table)
+		if table == "b" {
+			return errors.New("failed " + table)
+		}
+		return nil
+	})
+	if len(errs) != 1 || errs[0].Error() != "failed b" {
+		t.Error("expected error of b, got", errs)
+	}
+	if !slices.Equal(done, []string{"a", "b"}) {
+		t.Error("tables not processed in order up to the failed table", done)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/SENERGY-Platform/go-service-base/struct-logger/attributes"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+// PreviewRule renders the templates of rule for table without executing them.
+// Template errors are reported in the preview, not as error.
+func (this *impl) PreviewRule(rule *model.Rule, table string) (preview *model.RulePreview, code int, err error) {
+	columns, code, err := this.getColumns(table)
+	if err != nil {
+		return nil, code, err
+	}
+	tableInfo, code, err := this.getTableInfo(table)
+	if err != nil {
+		return nil, code, err
+	}
+	tableInfo.Columns = columns
+	tableInfo.Params = rule.Parameters
+	preview = &model.RulePreview{TableInfo: tableInfo}
+	preview.Command, err = renderTemplate(rule.CommandTemplate, tableInfo)
+	if err == nil {
+		err = this.checkPolicy(*rule, preview.Command, tableInfo, false)
+	}
+	if err != nil {
+		preview.CommandError = err.Error()
+	}
+	preview.Delete, err = renderTemplate(rule.DeleteTemplate, tableInfo)
+	if err == nil {
+		err = this.checkPolicy(*rule, preview.Delete, tableInfo, true)
+	}
+	if err != nil {
+		preview.DeleteError = err.Error()
+	}
+	return preview, http.StatusOK, nil
+}
+
+// DryRunRule executes the templates of the rule with the given id inside a transaction that is always rolled back.
+// Errors are reported per table and never saved to the rule. Requested tables have to exist and match the rule.
+func (this *impl) DryRunRule(id string, request model.DryRunRequest) (results []model.DryRunResult, code int, err error) {
+	err = this.lock()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	this.logDebug("locked db for DryRunRule " + id)
+	defer func() {
+		this.unlock()
+		this.logDebug("unlocked db for DryRunRule " + id)
+	}()
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	defer func() {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			log.Logger.Error("dry run rollback failed", attributes.ErrorKey, rollbackErr)
+		}
+	}()
+	_, err = this.db.GetRule(id, tx)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	matching, err := this.db.FindMatchingTables([]string{id}, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	tables := matching
+	if len(request.Tables) > 0 {
+		tables = request.Tables
+		for _, table := range tables {
+			_, code, err = this.getColumns(table)
+			if err != nil {
+				return nil, code, errors.New(table + ": " + err.Error())
+			}
+			if !slices.Contains(matching, table) {
+				return nil, http.StatusBadRequest, errors.New(table + ": table does not match the rule")
+			}
+		}
+	}
+	results = []model.DryRunResult{}
+	for _, table := range tables {
+		result, err := this.dryRunTable(id, table, request.Delete, tx)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		results = append(results, result)
+	}
+	return results, http.StatusOK, nil
+}
+
+func (this *impl) dryRunTable(id string, table string, useDeleteTemplate bool, tx *sql.Tx) (result model.DryRunResult, err error) {
+	result = model.DryRunResult{Table: table}
+	savepoint := "dry_run"
+	_, err = tx.Exec("SAVEPOINT " + savepoint + ";")
+	if err != nil {
+		return result, err
+	}
+	tableErr := func(err error) (model.DryRunResult, error) {
+		result.Success = false
+		result.Error = err.Error()
+		_, err = tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint + ";")
+		return result, err
+	}
+	ruleResults, _, err := this.applyRules(table, false, []string{id}, true, tx)
+	if err != nil {
+		return tableErr(err)
+	}
+	if len(ruleResults) == 0 {
+		return result, nil
+	}
+	result.Applied = true
+	result.Success = true
+	if ruleResults[0].err != nil {
+		result.Success = false
+		result.CommandError = ruleResults[0].err.Error()
+	}
+	if useDeleteTemplate {
+		ruleResults, _, err = this.applyRules(table, true, []string{id}, true, tx)
+		if err != nil {
+			return tableErr(err)
+		}
+		if len(ruleResults) > 0 && ruleResults[0].err != nil {
+			result.Success = false
+			result.DeleteError = ruleResults[0].err.Error()
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/go-service-base/struct-logger/attributes"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var driftMetric = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "timescale_rule_manager",
+	Name:      "drift",
+	Help:      "Number of drifted rule applications found by the last reconciliation of any instance by kind.",
+}, []string{"kind"})
+
+var reconcileErrorsMetric = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "timescale_rule_manager",
+	Name:      "reconcile_errors",
+	Help:      "Number of tables the last reconciliation could not check or apply again.",
+})
+
+var reconcileFinishedMetric = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "timescale_rule_manager",
+	Name:      "reconcile_last_finished_timestamp_seconds",
+	Help:      "Time the last reconciliation finished.",
+})
+
+var reappliedMetric = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "timescale_rule_manager",
+	Name:      "reconcile_reapplied_tables_total",
+	Help:      "Number of tables all rules have been applied to again because of drift by this instance.",
+})
+
+// GetDriftReport returns the report of the last reconciliation of any instance.
+func (this *impl) GetDriftReport() (report *model.DriftReport, code int, err error) {
+	report, err = this.db.GetDriftReport()
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, http.StatusNotFound, errors.New("no reconciliation has finished yet")
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	return report, http.StatusOK, nil
+}
+
+// startReconciler runs reconcile every interval until ctx is done.
+func (this *impl) startReconciler(interval time.Duration, autoApply bool, ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := this.reconcile(autoApply)
+				if err != nil {
+					log.Logger.Error("could not reconcile rules", attributes.ErrorKey, err)
+				}
+			}
+		}
+	}()
+}
+
+// reconcile checks all tables matching any rule and all tables with recorded applications for drift, see checkTable.
+// If autoApply is set, all rules are applied again to tables with drift other than orphaned applications,
+// by ApplyAllRulesForTable after all tables have been checked. The report replaces the saved report.
+// Only one instance reconciles at a time, see database.DB.TryLockReconciler. Other instances skip the run,
+// return a nil report and update the metrics from the saved report.
+func (this *impl) reconcile(autoApply bool) (report *model.DriftReport, err error) {
+	unlock, ok, err := this.db.TryLockReconciler()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		this.logDebug("reconciliation is running on another instance")
+		saved, err := this.db.GetDriftReport()
+		if err == nil {
+			setDriftMetrics(saved)
+		} else if !errors.Is(err, database.ErrNotFound) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	defer unlock()
+
+	report = &model.DriftReport{Started: time.Now(), Drift: []model.Drift{}, Reapplied: []string{}, Errors: []string{}}
+	log.Logger.Info("reconciling rules", "autoApply", autoApply)
+	tables, err := this.findMatchingTables(nil)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := this.db.ListAppliedTables()
+	if err != nil {
+		return nil, err
+	}
+	tables = append(tables, applied...)
+	sort.Strings(tables)
+	tables = slices.Compact(tables)
+
+	mux := sync.Mutex{}
+	drifted := []string{}
+	_ = this.forEachTable(tables, func(table string) error {
+		drift, err := this.checkTable(table)
+		mux.Lock()
+		defer mux.Unlock()
+		report.TablesChecked++
+		report.Drift = append(report.Drift, drift...)
+		if err != nil {
+			log.Logger.Warn("could not check table for drift", "table", table, attributes.ErrorKey, err)
+			report.Errors = append(report.Errors, table+": "+err.Error())
+		}
+		if slices.ContainsFunc(drift, func(d model.Drift) bool { return d.Kind != model.DriftKindOrphaned }) {
+			drifted = append(drifted, table)
+		}
+		return nil
+	})
+	// applied outside of forEachTable, ApplyAllRulesForTable may wait for the global lock, see lock
+	sort.Strings(drifted)
+	if autoApply {
+		for _, table := range drifted {
+			log.Logger.Info("applying rules to table again because of drift", "table", table)
+			_, err = this.ApplyAllRulesForTable(table, false)
+			if err != nil {
+				log.Logger.Warn("could not apply rules to table again", "table", table, attributes.ErrorKey, err)
+				report.Errors = append(report.Errors, table+": "+err.Error())
+				continue
+			}
+			report.Reapplied = append(report.Reapplied, table)
+		}
+	}
+	report.Finished = time.Now()
+	slices.SortFunc(report.Drift, func(a, b model.Drift) int {
+		return strings.Compare(a.Table+"/"+a.RuleId, b.Table+"/"+b.RuleId)
+	})
+	sort.Strings(report.Errors)
+
+	reappliedMetric.Add(float64(len(report.Reapplied)))
+	setDriftMetrics(report)
+	log.Logger.Info("reconciled rules", "tables", report.TablesChecked, "drift", len(report.Drift), "reapplied", len(report.Reapplied),
+		"errors", len(report.Errors), "duration", report.Finished.Sub(report.Started))
+	return report, this.db.SetDriftReport(report)
+}
+
+func setDriftMetrics(report *model.DriftReport) {
+	counts := map[model.DriftKind]int{model.DriftKindMissing: 0, model.DriftKindOutdated: 0, model.DriftKindOrphaned: 0, model.DriftKindObjectsMissing: 0}
+	for _, d := range report.Drift {
+		counts[d.Kind]++
+	}
+	for kind, count := range counts {
+		driftMetric.WithLabelValues(kind).Set(float64(count))
+	}
+	reconcileErrorsMetric.Set(float64(len(report.Errors)))
+	reconcileFinishedMetric.Set(float64(report.Finished.Unix()))
+}
+
+// checkTable compares the rules applying to the table with the recorded applications and the catalog.
+// Relations created by the command of an applied rule are expected to exist, see policy.Created.
+func (this *impl) checkTable(table string) (drift []model.Drift, err error) {
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer tx.Rollback()
+
+	applications, err := this.db.ListApplications("", table)
+	if err != nil {
+		return nil, err
+	}
+	unmatched := map[string]model.RuleApplication{}
+	for _, application := range applications {
+		unmatched[application.RuleId] = application
+	}
+	drift = []model.Drift{}
+	orphaned := func(detail string) {
+		for _, application := range applications {
+			if _, ok := unmatched[application.RuleId]; ok {
+				drift = append(drift, model.Drift{Table: table, RuleId: application.RuleId, Group: application.Group, Kind: model.DriftKindOrphaned, Detail: detail})
+			}
+		}
+	}
+
+	columns, err := this.db.GetColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		orphaned("table does not exist")
+		return drift, nil
+	}
+	tableInfo, _, err := this.getTableInfo(table)
+	if err != nil {
+		return nil, err
+	}
+	tableInfo.Columns = columns
+	rules, err := this.db.FindMatchingRulesWithOwnerInfo(table, tableInfo.UserIds, tableInfo.Roles, nil, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		application, ok := unmatched[rule.Id]
+		delete(unmatched, rule.Id)
+		ruleDrift := model.Drift{Table: table, RuleId: rule.Id, Group: rule.Group}
+		if !ok {
+			ruleDrift.Kind = model.DriftKindMissing
+			drift = append(drift, ruleDrift)
+			continue
+		}
+		ruleTableInfo := tableInfo
+		ruleTableInfo.Params = rule.Parameters
+		query, err := renderTemplate(rule.CommandTemplate, ruleTableInfo)
+		if err != nil {
+			ruleDrift.Kind = model.DriftKindOutdated
+			ruleDrift.Detail = "command template can not be rendered: " + err.Error()
+			drift = append(drift, ruleDrift)
+			continue
+		}
+		if commandHash(query) != application.CommandHash {
+			ruleDrift.Kind = model.DriftKindOutdated
+			drift = append(drift, ruleDrift)
+			continue
+		}
+		created := policy.Created(query)
+		if len(created) == 0 {
+			continue
+		}
+		existing, err := this.db.ExistingRelations(created, tx)
+		if err != nil {
+			return nil, err
+		}
+		missing := []string{}
+		for _, relation := range created {
+			if !slices.Contains(existing, relation) {
+				missing = append(missing, relation)
+			}
+		}
+		if len(missing) > 0 {
+			ruleDrift.Kind = model.DriftKindObjectsMissing
+			ruleDrift.Detail = "missing relations " + strings.Join(missing, ", ")
+			drift = append(drift, ruleDrift)
+		}
+	}
+	orphaned("rule does not apply to the table")
+	return drift, nil
+}
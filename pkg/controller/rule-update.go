@@ -0,0 +1,207 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+// updateRule replaces the previous version of the rule of the job with the current version on all tables.
+// Tables the previous version has been applied to are taken from the recorded applications, see recordApplication,
+// and from the tables the previous version matches, as applications before recording them are not known.
+// The result of each table is saved to the job. Like runRule, each table is changed in a transaction of its own and
+// a table the update failed on keeps the previous version, see forEachTableTx. The errors are saved to the rule.
+func (this *impl) updateRule(job *model.Job) error {
+	if job.PreviousRule == nil {
+		return errors.New("job is missing the previous version of the rule")
+	}
+	this.logDebug("updating rule " + job.RuleId)
+	err := this.lock()
+	if err != nil {
+		return err
+	}
+	this.logDebug("locked db for rule " + job.RuleId)
+	defer func() {
+		this.unlock()
+		this.logDebug("unlocked db for rule " + job.RuleId)
+	}()
+	rule, err := this.resetRuleStatus(job.RuleId)
+	if err != nil {
+		return err
+	}
+	tables, previousTables, err := this.findUpdatedTables(*job.PreviousRule, rule.Id)
+	if err != nil {
+		return this.finishRuleRun(rule.Id, []error{err})
+	}
+	this.logDebug("for rule " + rule.Id + " found tables " + strings.Join(tables, ", "))
+	job.Results = []model.TableResult{}
+	this.setJobProgress(job, 0, len(tables))
+
+	tx, cancel, err := this.getStrictTx()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	mux := sync.Mutex{}
+	processed := 0
+	errs := this.forEachTableTx(tables, tx, func(table string, tx *sql.Tx) error {
+		_, previousMatches := slices.BinarySearch(previousTables, table)
+		result, err := this.updateRuleForTable(*job.PreviousRule, *rule, table, previousMatches, tx)
+		if err != nil {
+			return errors.New(table + ": " + err.Error())
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		processed++
+		if result != nil {
+			job.Results = append(job.Results, *result)
+		}
+		this.setJobProgress(job, processed, len(tables))
+		if result != nil && len(result.Error) > 0 {
+			return errors.New(table + ": " + result.Error)
+		}
+		return nil
+	})
+	err = finishStrictTx(tx, errs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	slices.SortFunc(job.Results, func(a, b model.TableResult) int { return strings.Compare(a.Table, b.Table) })
+	this.setJobProgress(job, processed, len(tables))
+	return this.finishRuleRun(rule.Id, errs)
+}
+
+// findUpdatedTables returns the tables the current or the previous version of the rule may apply to
+// and the tables the previous version matches, both in order of the table names.
+func (this *impl) findUpdatedTables(previous model.Rule, id string) (tables []string, previousTables []string, err error) {
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cancel()
+	defer tx.Rollback()
+	tables, err = this.db.FindMatchingTables([]string{id}, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	applications, err := this.db.ListApplications(id, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	previousTables, err = this.db.FindTablesMatching(previous.TableRegEx, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, application := range applications {
+		tables = append(tables, application.Table)
+	}
+	tables = append(tables, previousTables...)
+	sort.Strings(tables)
+	return slices.Compact(tables), previousTables, nil
+}
+
+// updateRuleForTable runs the delete template of the previous version of the rule if the current version does not
+// apply to the table anymore or if the rendered command template changed. The command template of the current
+// version is run if it applies to the table. The previous version applies to the table if its application is
+// recorded or if previousMatches is set and it would have been selected for its group, see winsGroup.
+// Returns nil if neither version applies to the table.
+func (this *impl) updateRuleForTable(previous model.Rule, rule model.Rule, table string, previousMatches bool, tx *sql.Tx) (result *model.TableResult, err error) {
+	err = this.db.LockTable(table, tx)
+	if err != nil {
+		return nil, err
+	}
+	application, err := this.db.GetApplication(rule.Id, table, tx)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+	recorded := err == nil
+	tableInfo, _, err := this.getTableInfo(table)
+	if err != nil {
+		return nil, err
+	}
+	tableInfo.Columns, err = this.db.GetColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := this.db.FindMatchingRules([]string{table}, tx)
+	if err != nil {
+		return nil, err
+	}
+	wasApplied := recorded || (previousMatches && winsGroup(previous, tableInfo, candidates))
+	matches := slices.ContainsFunc(candidates, func(candidate model.Rule) bool { return candidate.Id == rule.Id })
+	applies := matches && winsGroup(rule, tableInfo, candidates)
+
+	result = &model.TableResult{Table: table}
+	switch {
+	case wasApplied && !applies:
+		result.Action = model.TableActionDelete
+	case wasApplied:
+		ruleTableInfo := tableInfo
+		ruleTableInfo.Params = rule.Parameters
+		query, err := renderTemplate(rule.CommandTemplate, ruleTableInfo)
+		previousHash := ""
+		if recorded {
+			previousHash = application.CommandHash
+		} else {
+			previousTableInfo := tableInfo
+			previousTableInfo.Params = previous.Parameters
+			previousQuery, err := renderTemplate(previous.CommandTemplate, previousTableInfo)
+			if err == nil {
+				previousHash = commandHash(previousQuery)
+			}
+		}
+		if err == nil && commandHash(query) == previousHash {
+			result.Action = model.TableActionApply
+		} else {
+			result.Action = model.TableActionReplace
+		}
+	case applies:
+		result.Action = model.TableActionApply
+	default:
+		return nil, nil
+	}
+	this.logDebug(result.Action + " rule " + rule.Id + " on table " + table)
+
+	if result.Action == model.TableActionDelete || result.Action == model.TableActionReplace {
+		ruleResult, _, err := this.applyRule(previous, tableInfo, true, false, tx)
+		if err != nil {
+			return nil, err
+		}
+		if ruleResult.err != nil {
+			result.Error = "delete template of previous version: " + ruleResult.err.Error()
+			return result, nil
+		}
+	}
+	if result.Action == model.TableActionApply || result.Action == model.TableActionReplace {
+		ruleResult, _, err := this.applyRule(rule, tableInfo, false, false, tx)
+		if err != nil {
+			return nil, err
+		}
+		if ruleResult.err != nil {
+			result.Error = ruleResult.err.Error()
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+// GetRuleTables lists all tables matching the TableRegEx of the rule with the given id
+// and reports if the rule is applied to each table.
+func (this *impl) GetRuleTables(id string) (tables []model.RuleTable, code int, err error) {
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	defer tx.Rollback()
+	rule, err := this.db.GetRule(id, tx)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	tableNames, err := this.db.FindMatchingTables([]string{id}, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	tables = []model.RuleTable{}
+	for _, table := range tableNames {
+		ruleTable := model.RuleTable{Table: table}
+		tableInfo, _, err := this.getTableInfo(table)
+		if err != nil {
+			ruleTable.Error = err.Error()
+			tables = append(tables, ruleTable)
+			continue
+		}
+		statuses, err := this.resolveRuleStatus(tableInfo, []model.Rule{*rule}, tx)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		ruleTable.Status = statuses[0].status
+		ruleTable.ShadowedBy = statuses[0].shadowedBy
+		ruleTable.OwnerMatch = ruleTable.Status != model.RuleStatusExcluded
+		ruleTable.WinsGroup = ruleTable.Status == model.RuleStatusApplied
+		tables = append(tables, ruleTable)
+	}
+	return tables, http.StatusOK, nil
+}
+
+// GetTableRules resolves the information available to templates for the table and lists all rules
+// matching the table by TableRegEx with their status.
+func (this *impl) GetTableRules(table string) (tableRules *model.TableRules, code int, err error) {
+	columns, code, err := this.getColumns(table)
+	if err != nil {
+		return nil, code, err
+	}
+	tableInfo, code, err := this.getTableInfo(table)
+	if err != nil {
+		return nil, code, err
+	}
+	tableInfo.Columns = columns
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	defer tx.Rollback()
+	candidates, err := this.db.FindMatchingRules([]string{table}, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	slices.SortFunc(candidates, func(a, b model.Rule) int {
+		return cmp.Or(cmp.Compare(a.Group, b.Group), cmp.Compare(b.Priority, a.Priority), cmp.Compare(a.Id, b.Id))
+	})
+	statuses, err := this.resolveRuleStatus(tableInfo, candidates, tx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	tableRules = &model.TableRules{TableInfo: tableInfo, Rules: []model.TableRule{}}
+	for i := range candidates {
+		typed, err := candidates[i].Type()
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		tableRules.Rules = append(tableRules.Rules, model.TableRule{TypedRule: *typed, Status: statuses[i].status, ShadowedBy: statuses[i].shadowedBy})
+	}
+	return tableRules, http.StatusOK, nil
+}
+
+type ruleStatus struct {
+	status     model.RuleStatus
+	shadowedBy string
+}
+
+// resolveRuleStatus determines the status of each candidate rule on the table of tableInfo. The candidates
+// are expected to match the table by TableRegEx. The rules applied per group are selected the same way as in applyRules.
+func (this *impl) resolveRuleStatus(tableInfo model.TableInfo, candidates []model.Rule, tx *sql.Tx) (statuses []ruleStatus, err error) {
+	applied, err := this.db.FindMatchingRulesWithOwnerInfo(tableInfo.Table, tableInfo.UserIds, tableInfo.Roles, nil, tx)
+	if err != nil {
+		return nil, err
+	}
+	appliedByGroup := map[string]string{}
+	for _, rule := range applied {
+		appliedByGroup[rule.Group] = rule.Id
+	}
+	statuses = make([]ruleStatus, len(candidates))
+	for i, rule := range candidates {
+		switch {
+		case !ownersMatch(rule, tableInfo):
+			statuses[i].status = model.RuleStatusExcluded
+		case appliedByGroup[rule.Group] == rule.Id:
+			statuses[i].status = model.RuleStatusApplied
+		default:
+			statuses[i].status = model.RuleStatusShadowed
+			statuses[i].shadowedBy = appliedByGroup[rule.Group]
+		}
+	}
+	return statuses, nil
+}
+
+// ownersMatch mirrors the owner check of database.FindMatchingRulesWithOwnerInfo.
+func ownersMatch(rule model.Rule, tableInfo model.TableInfo) bool {
+	for _, user := range rule.Users {
+		if slices.Contains(tableInfo.UserIds, user) {
+			return true
+		}
+	}
+	for _, role := range rule.Roles {
+		if slices.Contains(tableInfo.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// winsGroup checks if the rule would be selected for its group on the table of tableInfo, like
+// database.DB.FindMatchingRulesWithOwnerInfo does for rules stored in the database. The candidates are the rules
+// matching the table by TableRegEx, other versions of the rule among them are ignored.
+func winsGroup(rule model.Rule, tableInfo model.TableInfo, candidates []model.Rule) bool {
+	if !ownersMatch(rule, tableInfo) {
+		return false
+	}
+	return !slices.ContainsFunc(candidates, func(other model.Rule) bool {
+		return other.Id != rule.Id && other.Group == rule.Group && other.Priority > rule.Priority && ownersMatch(other, tableInfo)
+	})
+}
+
+// getColumns returns the columns of the table. Tables without columns do not exist and are reported with
+// http.StatusNotFound, so that nothing is resolved or rendered for them.
+func (this *impl) getColumns(table string) (columns []string, code int, err error) {
+	columns, err = this.db.GetColumns(table)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if len(columns) == 0 {
+		return nil, http.StatusNotFound, errors.New("table not found")
+	}
+	return columns, http.StatusOK, nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/database"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+func (this *impl) ListTemplateRules(options model.RuleListOptions) (templateRules []model.TemplateRule, total int, code int, err error) {
+	options.Type = model.RuleTypeTemplate
+	err = options.Validate()
+	if err != nil {
+		return nil, 0, http.StatusBadRequest, err
+	}
+	rules, total, err := this.db.ListRules(options)
+	if err != nil {
+		return nil, 0, http.StatusInternalServerError, err
+	}
+	templateRules = []model.TemplateRule{}
+	for _, rule := range rules {
+		templateRule, err := rule.TemplateRule()
+		if err != nil {
+			return nil, 0, http.StatusInternalServerError, err
+		}
+		templateRules = append(templateRules, *templateRule)
+	}
+	return templateRules, total, http.StatusOK, nil
+}
+
+func (this *impl) GetTemplateRule(id string) (templateRule *model.TemplateRule, code int, err error) {
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	defer tx.Rollback()
+	rule, err := this.db.GetRule(id, tx)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	templateRule, err = rule.TemplateRule()
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	return templateRule, http.StatusOK, nil
+}
+
+// migrateTemplateRules stores the template name, target and version with rules that were saved before
+// these fields existed. The template is inferred by comparing the rule with all known templates, only for rules
+// without a template name. Rules with a template name are never changed, if their template version is 0 they are
+// listed as outdated. The version of the rules is not changed.
+func (this *impl) migrateTemplateRules() error {
+	rules, err := this.listAllRules(model.RuleListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if len(rule.TemplateName) > 0 {
+			continue
+		}
+		found, err := rule.InferTemplate()
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		log.Logger.Info("storing template of rule", "ruleId", rule.Id, "template", rule.TemplateName)
+		tx, cancel, err := this.db.GetTx()
+		if err != nil {
+			return err
+		}
+		err = this.db.UpdateRuleTemplate(&rule, tx)
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			_ = tx.Rollback()
+		}
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
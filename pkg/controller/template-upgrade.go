@@ -0,0 +1,197 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SENERGY-Platform/go-service-base/struct-logger/attributes"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+)
+
+// ListOutdatedTemplateRules lists the rules created from an older version of the template with the given name.
+func (this *impl) ListOutdatedTemplateRules(name string) (templateRules []model.TemplateRule, code int, err error) {
+	tmpl, code, err := this.GetTemplate(name)
+	if err != nil {
+		return nil, code, err
+	}
+	rules, err := this.listAllRules(model.RuleListOptions{Template: tmpl.Name, TemplateVersionBefore: tmpl.Version})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	templateRules = []model.TemplateRule{}
+	for _, rule := range rules {
+		templateRule, err := rule.TemplateRule()
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		templateRules = append(templateRules, *templateRule)
+	}
+	return templateRules, http.StatusOK, nil
+}
+
+// UpgradeTemplateRules queues a job upgrading all outdated rules of the template with the given name
+// to the current version of the template.
+func (this *impl) UpgradeTemplateRules(name string, requestId string) (job *model.Job, code int, err error) {
+	_, code, err = this.GetTemplate(name)
+	if err != nil {
+		return nil, code, err
+	}
+	job, err = newJob(model.JobTypeUpgradeTemplate, "", requestId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	job.Template = name
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	return this.queueJob(job, tx)
+}
+
+// upgradeTemplateRules upgrades each outdated rule of the template of the job. Rules are upgraded
+// independently of each other, a failed rule keeps its old version and the error is saved to the rule.
+func (this *impl) upgradeTemplateRules(job *model.Job) error {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return err
+	}
+	tmpl, ok := ts.Get(job.Template)
+	if !ok {
+		return templates.ErrTemplateNotFound
+	}
+	err = this.lock()
+	if err != nil {
+		return err
+	}
+	defer this.unlock()
+
+	rules, err := this.listAllRules(model.RuleListOptions{Template: tmpl.Name, TemplateVersionBefore: tmpl.Version})
+	if err != nil {
+		return err
+	}
+	ruleTables := make([][]string, len(rules))
+	total := 0
+	for i, rule := range rules {
+		ruleTables[i], err = this.findMatchingTables([]string{rule.Id})
+		if err != nil {
+			return err
+		}
+		total += len(ruleTables[i])
+	}
+	processed := 0
+	this.setJobProgress(job, processed, total)
+
+	failed := []string{}
+	for i, rule := range rules {
+		err = this.upgradeRule(rule, ruleTables[i], func() {
+			processed++
+			this.setJobProgress(job, processed, total)
+		})
+		if err != nil {
+			log.Logger.Warn("could not upgrade rule", "ruleId", rule.Id, "template", tmpl.Name, attributes.ErrorKey, err)
+			failed = append(failed, rule.Id)
+			rule.Errors = append(rule.Errors, "upgrade to template version "+strconv.FormatInt(tmpl.Version, 10)+": "+err.Error())
+			err = this.saveRule(&rule)
+			if err != nil {
+				log.Logger.Error("save rule failed", attributes.ErrorKey, err)
+			}
+		}
+	}
+	this.setJobProgress(job, total, total)
+	if len(failed) > 0 {
+		return errors.New("rules could not be upgraded: " + strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// upgradeRule replaces the rule with the current version of its template on each of its tables, like updateRule, and
+// saves the upgraded rule if it could be upgraded on every table. Each table is changed in a transaction of its own,
+// see forEachTableTx, so tables the upgrade succeeded on keep the upgraded version if it failed on another table.
+// With StrictOrdering, changes are only committed if the rule could be upgraded on every table.
+func (this *impl) upgradeRule(rule model.Rule, tables []string, tableDone func()) error {
+	templateRule, err := rule.TemplateRule()
+	if err != nil {
+		return err
+	}
+	upgraded, err := templateRule.Rule()
+	if err != nil {
+		return err
+	}
+	// applications are recorded with the version the rule has after saving it
+	applied := *upgraded
+	applied.Version++
+	tx, cancel, err := this.getStrictTx()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	mux := sync.Mutex{}
+	errs := this.forEachTableTx(tables, tx, func(table string, tx *sql.Tx) error {
+		defer func() {
+			mux.Lock()
+			defer mux.Unlock()
+			tableDone()
+		}()
+		result, err := this.updateRuleForTable(rule, applied, table, true, tx)
+		if err != nil {
+			return errors.New(table + ": " + err.Error())
+		}
+		if result != nil && len(result.Error) > 0 {
+			return errors.New(table + ": " + result.Error)
+		}
+		return nil
+	})
+	if len(errs) > 0 {
+		_ = finishStrictTx(tx, errs)
+		return errors.Join(errs...)
+	}
+	if tx == nil {
+		tx, cancel, err = this.db.GetTx()
+		if err != nil {
+			return err
+		}
+		defer cancel()
+	}
+	upgraded.Errors = []string{}
+	upgraded.CompletedRun = true
+	err = this.db.UpdateRule(upgraded, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// findMatchingTables returns the tables matching any of the rules, see database.DB.FindMatchingTables.
+func (this *impl) findMatchingTables(ruleIds []string) (tables []string, err error) {
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer tx.Rollback()
+	return this.db.FindMatchingTables(ruleIds, tx)
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+)
+
+// ListTemplates lists all templates by name, including templates that could not be loaded.
+func (this *impl) ListTemplates() (list map[string]templates.TemplateInfo, code int, err error) {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return ts.Status(), http.StatusOK, nil
+}
+
+func (this *impl) ListTemplateRuleTargets() (targets []templates.Target, code int, err error) {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return ts.Targets(), http.StatusOK, nil
+}
+
+func (this *impl) GetTemplate(name string) (tmpl *templates.Template, code int, err error) {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	t, ok := ts.Get(name)
+	if !ok {
+		return nil, http.StatusNotFound, templates.ErrTemplateNotFound
+	}
+	return &t, http.StatusOK, nil
+}
+
+// SetTemplate creates or updates the template with the name of tmpl and returns the stored template.
+// The version of the template is incremented on changes. Rules created from the template are not
+// changed, see UpgradeTemplateRules.
+func (this *impl) SetTemplate(tmpl templates.Template, create bool) (result *templates.Template, code int, err error) {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	err = validateTemplate(tmpl)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	tx, cancel, err := this.db.GetTx()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer cancel()
+	// releases the lock of the dependencies once the template is stored
+	defer tx.Rollback()
+	code, err = this.checkDependencies(nil, &tmpl, tx)
+	if err != nil {
+		return nil, code, err
+	}
+	if create {
+		tmpl, err = ts.Create(tmpl)
+	} else {
+		tmpl, err = ts.Update(tmpl)
+	}
+	if err != nil {
+		if errors.Is(err, templates.ErrTemplateExists) {
+			return nil, http.StatusConflict, err
+		}
+		if errors.Is(err, templates.ErrTemplateNotFound) {
+			return nil, http.StatusNotFound, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	return &tmpl, http.StatusOK, nil
+}
+
+// DeleteTemplate deletes the template with the given name if no rule has been created from it.
+func (this *impl) DeleteTemplate(name string) (code int, err error) {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	_, total, err := this.db.ListRules(model.RuleListOptions{Template: name, Limit: 1})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if total > 0 {
+		return http.StatusConflict, errors.New("template is used by rules")
+	}
+	err = ts.Delete(name)
+	if err != nil {
+		if errors.Is(err, templates.ErrTemplateNotFound) {
+			return http.StatusNotFound, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// validateTemplate checks that tmpl has a name and can be rendered, see templates.Template.Validate.
+func validateTemplate(tmpl templates.Template) error {
+	if len(tmpl.Name) == 0 {
+		return errors.New("missing name")
+	}
+	return tmpl.Validate()
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+func (this *impl) applicationTable() string {
+	return this.ruleTable + "_applications"
+}
+
+// SetApplication saves the application, replacing an earlier application of the rule to the same table.
+func (this *impl) SetApplication(application *model.RuleApplication, tx *sql.Tx) (err error) {
+	fields, values := getFieldsAndValues(application)
+	updates := make([]string, len(fields))
+	for i, field := range fields {
+		updates[i] = "\"" + field + "\" = EXCLUDED.\"" + field + "\""
+	}
+	query := fmt.Sprintf("INSERT INTO \"%s\".\"%s\" (\"%s\") VALUES (%s) ON CONFLICT (\"RuleId\", \"Table\") DO UPDATE SET %s;",
+		this.ruleSchema, this.applicationTable(), strings.Join(fields, "\", \""), strings.Join(values, ", "), strings.Join(updates, ", "))
+	_, err = tx.Exec(query)
+	return err
+}
+
+// GetApplication returns the application of the rule to the table. Returns ErrNotFound if the rule is not applied to the table.
+func (this *impl) GetApplication(ruleId string, table string, tx *sql.Tx) (application *model.RuleApplication, err error) {
+	r := tx.QueryRow(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" WHERE \"RuleId\" = $1 AND \"Table\" = $2", this.ruleSchema, this.applicationTable()), ruleId, table)
+	application = &model.RuleApplication{}
+	err = scanApplication(r, application)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return application, nil
+}
+
+func (this *impl) DeleteApplication(ruleId string, table string, tx *sql.Tx) (err error) {
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM \"%s\".\"%s\" WHERE \"RuleId\" = $1 AND \"Table\" = $2;", this.ruleSchema, this.applicationTable()), ruleId, table)
+	return err
+}
+
+// ListApplications lists the applications of the rule ordered by table if ruleId is set, or the applications
+// to the table ordered by rule id otherwise.
+func (this *impl) ListApplications(ruleId string, table string) (applications []model.RuleApplication, err error) {
+	query := fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" WHERE \"RuleId\" = $1 ORDER BY \"Table\"", this.ruleSchema, this.applicationTable())
+	arg := ruleId
+	if len(ruleId) == 0 {
+		query = fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" WHERE \"Table\" = $1 ORDER BY \"RuleId\"", this.ruleSchema, this.applicationTable())
+		arg = table
+	}
+	rows, err := this.sql.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applications = []model.RuleApplication{}
+	for rows.Next() {
+		application := model.RuleApplication{}
+		err = scanApplication(rows, &application)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+	return applications, rows.Err()
+}
+
+// ListAppliedTables lists all tables any rule has been applied to, ordered by name.
+func (this *impl) ListAppliedTables() (tables []string, err error) {
+	return this.queryStrings(fmt.Sprintf("SELECT DISTINCT \"Table\" FROM \"%s\".\"%s\" ORDER BY \"Table\"", this.ruleSchema, this.applicationTable()), this.sql)
+}
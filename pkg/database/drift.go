@@ -0,0 +1,74 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+func (this *impl) driftTable() string {
+	return this.ruleTable + "_drift"
+}
+
+// SetDriftReport replaces the saved drift report.
+func (this *impl) SetDriftReport(report *model.DriftReport) (err error) {
+	return this.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(fmt.Sprintf("DELETE FROM \"%s\".\"%s\";", this.ruleSchema, this.driftTable()))
+		if err != nil {
+			return err
+		}
+		return this.insert(this.driftTable(), report, tx)
+	})
+}
+
+// GetDriftReport returns the saved drift report. Returns ErrNotFound if no report has been saved yet.
+func (this *impl) GetDriftReport() (report *model.DriftReport, err error) {
+	r := this.sql.QueryRow(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" ORDER BY \"Finished\" DESC LIMIT 1", this.ruleSchema, this.driftTable()))
+	report = &model.DriftReport{}
+	err = r.Scan(&report.Started, &report.Finished, &report.TablesChecked, jsonColumn{&report.Drift},
+		jsonColumn{&report.Reapplied}, jsonColumn{&report.Errors})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return report, nil
+}
+
+// TryLockReconciler takes the advisory lock electing the instance running the reconciliation, without waiting.
+// The lock is held by a connection of its own until unlock is called. ok is false if another instance holds the lock.
+func (this *impl) TryLockReconciler() (unlock func(), ok bool, err error) {
+	conn, err := this.sql.Conn(this.ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	err = conn.QueryRowContext(this.ctx, "SELECT pg_try_advisory_lock(hashtextextended('reconciler', $1));", this.lockKey).Scan(&ok)
+	if err != nil || !ok {
+		_ = conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtextextended('reconciler', $1));", this.lockKey)
+		_ = conn.Close()
+	}, true, nil
+}
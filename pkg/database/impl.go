@@ -21,6 +21,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,13 +29,14 @@ import (
 	"github.com/SENERGY-Platform/models/go/models"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type impl struct {
 	ruleSchema string
 	ruleTable  string
 	sql        *sql.DB
+	connStr    string
 	ctx        context.Context
 	timeout    time.Duration
 	lockKey    int64
@@ -68,7 +70,7 @@ func New(postgresHost string, postgresPort int, postgresUser string, postgresPw
 		_ = db.Close()
 		return nil, err
 	}
-	i := &impl{sql: db, ctx: ctx, ruleSchema: postgresRuleSchema, ruleTable: postgresRuleTable, timeout: timeoutD, lockKey: lockKey, debug: debug}
+	i := &impl{sql: db, connStr: psqlconn, ctx: ctx, ruleSchema: postgresRuleSchema, ruleTable: postgresRuleTable, timeout: timeoutD, lockKey: lockKey, debug: debug}
 	return i, i.migrate()
 }
 
@@ -87,37 +89,64 @@ func (this *impl) GetTx() (tx *sql.Tx, cancel context.CancelFunc, err error) {
 }
 
 func (this *impl) InsertRule(rule *model.Rule, tx *sql.Tx) (err error) {
-	query := fmt.Sprintf("INSERT INTO \"%s\".\"%s\" (", this.ruleSchema, this.ruleTable)
-	fields, values := getFieldsAndValues(rule)
-	valueStr := "VALUES ("
-	for i := range fields {
-		if i > 0 {
-			query += ", "
-			valueStr += ", "
+	return this.insert(this.ruleTable, rule, tx)
+}
+
+// UpdateRule overwrites the rule if its Version matches the saved version and increments the Version of rule.
+// Returns ErrVersionMismatch if the rule has been updated in the meantime.
+func (this *impl) UpdateRule(rule *model.Rule, tx *sql.Tx) (err error) {
+	expectedVersion := rule.Version
+	rule.Version++
+	err = this.updateWithCondition(this.ruleTable, rule.Id, rule, fmt.Sprintf("\"Version\" = %d", expectedVersion), tx)
+	if err != nil {
+		rule.Version = expectedVersion
+	}
+	if errors.Is(err, ErrNotFound) {
+		var exists bool
+		err = tx.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM \"%s\".\"%s\" WHERE \"Id\" = $1)", this.ruleSchema, this.ruleTable), rule.Id).Scan(&exists)
+		if err != nil {
+			return err
 		}
-		query += "\"" + fields[i] + "\""
-		valueStr += values[i]
+		if exists {
+			return ErrVersionMismatch
+		}
+		return ErrNotFound
+	}
+	return err
+}
+
+// UpdateRuleStatus only saves Errors and CompletedRun of the rule. The Version is not changed.
+func (this *impl) UpdateRuleStatus(rule *model.Rule, tx *sql.Tx) (err error) {
+	res, err := tx.Exec(fmt.Sprintf("UPDATE \"%s\".\"%s\" SET \"Errors\" = $1, \"CompletedRun\" = $2 WHERE \"Id\" = $3;", this.ruleSchema, this.ruleTable),
+		pq.StringArray(rule.Errors), rule.CompletedRun, rule.Id)
+	if err != nil {
+		return err
 	}
-	valueStr += ")"
-	query += ") " + valueStr + ";"
-	_, err = tx.Exec(query)
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
-func (this *impl) UpdateRule(rule *model.Rule, tx *sql.Tx) (err error) {
-	query := fmt.Sprintf("UPDATE \"%s\".\"%s\" SET ", this.ruleSchema, this.ruleTable)
-	fields, values := getFieldsAndValues(rule)
-	for i := range fields {
-		if i > 0 {
-			query += ", "
-		}
-		query += "\"" + fields[i] + "\" = " + values[i]
-	}
-	query += " WHERE \"Id\" = '" + rule.Id + "';"
-	res, err := tx.Exec(query)
+// UpdateRuleTemplate only saves TemplateName, TemplateTarget and TemplateVersion of the rule if no template name is set yet
+// and the rule was not changed since it was read. The Version is not changed. Rules that were already updated are
+// skipped without error, so that instances can run this concurrently.
+func (this *impl) UpdateRuleTemplate(rule *model.Rule, tx *sql.Tx) (err error) {
+	_, err = tx.Exec(fmt.Sprintf("UPDATE \"%s\".\"%s\" SET \"TemplateName\" = $1, \"TemplateTarget\" = $2, \"TemplateVersion\" = $3 "+
+		"WHERE \"Id\" = $4 AND \"Version\" = $5 AND \"TemplateName\" = '';", this.ruleSchema, this.ruleTable),
+		rule.TemplateName, rule.TemplateTarget, rule.TemplateVersion, rule.Id, rule.Version)
+	return err
+}
+
+// AppendRuleError adds ruleErr to the Errors of the saved rule. Unlike UpdateRuleStatus, errors saved
+// concurrently by other transactions are kept.
+func (this *impl) AppendRuleError(ruleId string, ruleErr string, tx *sql.Tx) (err error) {
+	res, err := tx.Exec(fmt.Sprintf("UPDATE \"%s\".\"%s\" SET \"Errors\" = array_append(coalesce(\"Errors\", '{}'), $1) WHERE \"Id\" = $2;", this.ruleSchema, this.ruleTable),
+		ruleErr, ruleId)
 	if err != nil {
 		return err
 	}
@@ -136,6 +165,10 @@ func (this *impl) DeleteRule(id string, tx *sql.Tx) (err error) {
 	if err != nil {
 		return err
 	}
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM \"%s\".\"%s\" WHERE \"RuleId\" = $1;", this.ruleSchema, this.applicationTable()), id)
+	if err != nil {
+		return err
+	}
 	affected, err := res.RowsAffected()
 	if affected == 0 {
 		return ErrNotFound
@@ -156,41 +189,136 @@ func (this *impl) GetRule(id string, tx *sql.Tx) (rule *model.Rule, err error) {
 	return rule, nil
 }
 
-func (this *impl) ListRules(limit, offset int) (rules []model.Rule, err error) {
-	rows, err := this.sql.Query(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" LIMIT %d OFFSET %d",
-		this.ruleSchema, this.ruleTable, limit, offset))
+var ruleSortColumns = map[string]string{
+	"id":            "Id",
+	"description":   "Description",
+	"priority":      "Priority",
+	"group":         "Group",
+	"table_reg_ex":  "TableRegEx",
+	"completed_run": "CompletedRun",
+}
+
+// ListRules returns a page of the rules matching the options and the total number of matching rules.
+func (this *impl) ListRules(options model.RuleListOptions) (rules []model.Rule, total int, err error) {
+	where, args, err := ruleListConditions(options)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	sortColumn := "Id"
+	if len(options.Sort) > 0 {
+		var ok bool
+		sortColumn, ok = ruleSortColumns[options.Sort]
+		if !ok {
+			return nil, 0, errors.New("unknown sort field " + options.Sort)
+		}
+	}
+	order := "ASC"
+	if options.Order == "desc" {
+		order = "DESC"
 	}
+	err = this.sql.QueryRow(fmt.Sprintf("SELECT count(*) FROM \"%s\".\"%s\" WHERE %s",
+		this.ruleSchema, this.ruleTable, where), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := this.sql.Query(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" WHERE %s ORDER BY \"%s\" %s, \"Id\" LIMIT %d OFFSET %d",
+		this.ruleSchema, this.ruleTable, where, sortColumn, order, options.Limit, options.Offset), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	rules = []model.Rule{}
 	for rows.Next() {
 		rule := model.Rule{}
 		err = scan(rows, &rule)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		rules = append(rules, rule)
 	}
-	return rules, nil
+	return rules, total, rows.Err()
 }
 
+// ruleListConditions builds the WHERE clause and its arguments for the filters of options.
+func ruleListConditions(options model.RuleListOptions) (where string, args []any, err error) {
+	conditions := []string{"TRUE"}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if len(options.Group) > 0 {
+		conditions = append(conditions, "\"Group\" = "+arg(options.Group))
+	}
+	if len(options.User) > 0 {
+		conditions = append(conditions, arg(options.User)+" = ANY(\"Users\")")
+	}
+	if len(options.Role) > 0 {
+		conditions = append(conditions, arg(options.Role)+" = ANY(\"Roles\")")
+	}
+	if options.CompletedRun != nil {
+		conditions = append(conditions, "\"CompletedRun\" = "+arg(*options.CompletedRun))
+	}
+	if options.HasErrors != nil {
+		hasErrors := "cardinality(COALESCE(\"Errors\", '{}')) > 0"
+		if !*options.HasErrors {
+			hasErrors = "NOT " + hasErrors
+		}
+		conditions = append(conditions, hasErrors)
+	}
+	if len(options.Owner) > 0 {
+		conditions = append(conditions, "\"Users\" = ARRAY["+arg(options.Owner)+"]::text[] AND cardinality(COALESCE(\"Roles\", '{}')) = 0")
+	}
+	if len(options.Target) > 0 {
+		conditions = append(conditions, "\"TemplateTarget\" = "+arg(options.Target))
+	}
+	if len(options.Template) > 0 {
+		conditions = append(conditions, "\"TemplateName\" = "+arg(options.Template))
+	}
+	if options.TemplateVersionBefore > 0 {
+		conditions = append(conditions, "\"TemplateVersion\" < "+arg(options.TemplateVersionBefore))
+	}
+	switch options.Type {
+	case model.RuleTypeTemplate:
+		conditions = append(conditions, "\"TemplateName\" <> ''")
+	case model.RuleTypeCustom:
+		conditions = append(conditions, "\"TemplateName\" = ''")
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// FindMatchingTables returns each table matching any of the rules once, ordered by name. All rules are
+// considered if ruleIds is nil. Tables are always locked in this order to avoid deadlocks, see LockTable.
 func (this *impl) FindMatchingTables(ruleIds []string, tx *sql.Tx) (tables []string, err error) {
-	query := fmt.Sprintf("SELECT information_schema.tables.table_name "+
-		"FROM information_schema.tables, \"%s\".\"%s\" WHERE information_schema.tables.table_schema = 'public' AND information_schema.tables.table_name ~ \"%s\".\"%s\".\"TableRegEx\" AND \"%s\".\"%s\".\"Id\"IN ('"+strings.Join(ruleIds, "', '")+"');",
-		this.ruleSchema, this.ruleTable,
+	query := fmt.Sprintf("SELECT DISTINCT information_schema.tables.table_name "+
+		"FROM information_schema.tables, \"%s\".\"%s\" WHERE information_schema.tables.table_schema = 'public' AND information_schema.tables.table_name ~ \"%s\".\"%s\".\"TableRegEx\"",
 		this.ruleSchema, this.ruleTable,
 		this.ruleSchema, this.ruleTable,
 	)
-	return this.queryStrings(query, tx)
+	args := []any{}
+	if ruleIds != nil {
+		query += fmt.Sprintf(" AND \"%s\".\"%s\".\"Id\" = ANY($1)",
+			this.ruleSchema, this.ruleTable,
+		)
+		args = append(args, pq.StringArray(ruleIds))
+	}
+	query += " ORDER BY information_schema.tables.table_name;"
+	return this.queryStrings(query, tx, args...)
+}
+
+// FindTablesMatching returns the tables matching the regular expression in order of the table names,
+// like FindMatchingTables does for the TableRegEx of rules.
+func (this *impl) FindTablesMatching(regex string, tx *sql.Tx) (tables []string, err error) {
+	return this.queryStrings("SELECT DISTINCT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_name ~ $1 ORDER BY table_name;", tx, regex)
 }
 
 func (this *impl) FindMatchingRules(tables []string, tx *sql.Tx) (rules []model.Rule, err error) {
 	query := fmt.Sprintf("SELECT \"%s\".\"%s\".* "+
-		"FROM information_schema.tables, \"%s\".\"%s\" WHERE information_schema.tables.table_schema = 'public' AND information_schema.tables.table_name ~ \"%s\".\"%s\".\"TableRegEx\" AND information_schema.tables.table_name IN ('"+strings.Join(tables, "', '")+"');",
+		"FROM information_schema.tables, \"%s\".\"%s\" WHERE information_schema.tables.table_schema = 'public' AND information_schema.tables.table_name ~ \"%s\".\"%s\".\"TableRegEx\" AND information_schema.tables.table_name = ANY($1);",
 		this.ruleSchema, this.ruleTable,
 		this.ruleSchema, this.ruleTable,
 		this.ruleSchema, this.ruleTable,
 	)
-	rows, err := tx.Query(query)
+	rows, err := tx.Query(query, pq.StringArray(tables))
 	if err != nil {
 		return nil, err
 	}
@@ -216,34 +344,54 @@ func (this *impl) FindDeviceTables(deviceId string) (tables []string, err error)
 }
 
 func (this *impl) GetColumns(table string) (columns []string, err error) {
-	query := fmt.Sprintf("SELECT column_name FROM information_schema.columns where table_name = '%s' AND table_schema = 'public';", table)
-	return this.queryStrings(query, this.sql)
+	return this.queryStrings("SELECT column_name FROM information_schema.columns where table_name = $1 AND table_schema = 'public';", this.sql, table)
+}
+
+// ExistingRelations returns the schema qualified names of relations like public.name, ignoring names that do not exist.
+func (this *impl) ExistingRelations(names []string, tx *sql.Tx) (existing []string, err error) {
+	rows, err := tx.Query("SELECT n.nspname || '.' || c.relname FROM pg_catalog.pg_class c "+
+		"JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname || '.' || c.relname = ANY($1);", pq.StringArray(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	existing = []string{}
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		existing = append(existing, name)
+	}
+	return existing, rows.Err()
 }
 
 func (this *impl) FindMatchingRulesWithOwnerInfo(table string, userIds []string, roles []string, limitToRuleIds []string, tx *sql.Tx) (rules []model.Rule, err error) {
 	query := fmt.Sprintf("SELECT DISTINCT ON (\"%s\".\"%s\".\"Group\") \"%s\".\"%s\".* "+ // only one rule per Group
 		"FROM information_schema.tables, \"%s\".\"%s\" WHERE information_schema.tables.table_schema = 'public' "+ // table is in schema public
 		"AND information_schema.tables.table_name ~ \"%s\".\"%s\".\"TableRegEx\" "+ // table matches rule regex
-		"AND information_schema.tables.table_name = '%s' "+ // table name matches
+		"AND information_schema.tables.table_name = $1 "+ // table name matches
 		"AND ("+ // roles or user matches
-		"	\"%s\".\"%s\".\"Roles\" && ARRAY['"+strings.Join(roles, "', '")+"'] "+ // any roles overlap
-		"	OR \"%s\".\"%s\".\"Users\" && ARRAY['"+strings.Join(userIds, "', '")+"']"+ // any userIds overlap
+		"	\"%s\".\"%s\".\"Roles\" && $2::text[] "+ // any roles overlap
+		"	OR \"%s\".\"%s\".\"Users\" && $3::text[]"+ // any userIds overlap
 		")", // ensures DISTINCT ON selects rule with the highest Priority per Group
 		this.ruleSchema, this.ruleTable,
 		this.ruleSchema, this.ruleTable,
 		this.ruleSchema, this.ruleTable,
 		this.ruleSchema, this.ruleTable,
-		table,
 		this.ruleSchema, this.ruleTable,
 		this.ruleSchema, this.ruleTable,
 	)
+	args := []any{table, pq.StringArray(roles), pq.StringArray(userIds)}
 	if limitToRuleIds != nil {
-		query += fmt.Sprintf(" AND \"%s\".\"%s\".\"Id\" IN ('"+strings.Join(limitToRuleIds, "', '")+"')",
+		query += fmt.Sprintf(" AND \"%s\".\"%s\".\"Id\" = ANY($4)",
 			this.ruleSchema, this.ruleTable,
 		)
+		args = append(args, pq.StringArray(limitToRuleIds))
 	}
 	query += " ORDER BY \"Group\", \"Priority\" DESC;"
-	rows, err := tx.Query(query)
+	rows, err := tx.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -277,3 +425,40 @@ func (this *impl) Unlock() error {
 	_, err := this.sql.Exec(fmt.Sprintf("SELECT pg_advisory_unlock(%v);", this.lockKey))
 	return err
 }
+
+// LockTable waits for an advisory lock of the table that is held until tx ends.
+// The lock key is a hash of the table name seeded with the lock key of Lock.
+func (this *impl) LockTable(table string, tx *sql.Tx) error {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended($1, $2));", table, this.lockKey)
+	return err
+}
+
+// LockDependencies locks the dependencies of all rules and templates until tx ends. Dependencies listed after
+// locking include the dependencies saved by transactions that locked them before.
+func (this *impl) LockDependencies(tx *sql.Tx) error {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended('dependencies', $1));", this.lockKey)
+	return err
+}
+
+// ListDependencies returns the dependencies of the groups of all rules and templates, except of the rule with the id
+// excludeRuleId and the template with the name excludeTemplate.
+func (this *impl) ListDependencies(excludeRuleId string, excludeTemplate string, tx *sql.Tx) (deps model.GroupDependencies, err error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT \"Group\", \"DependsOn\" FROM \"%s\".\"%s\" WHERE \"Id\" <> $1 "+
+		"UNION ALL SELECT \"Group\", \"DependsOn\" FROM \"%s\".\"%s\" WHERE \"Name\" <> $2",
+		this.ruleSchema, this.ruleTable, this.ruleSchema, this.templateTable()), excludeRuleId, excludeTemplate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deps = model.GroupDependencies{}
+	for rows.Next() {
+		var group sql.NullString
+		var dependsOn pq.StringArray
+		err = rows.Scan(&group, &dependsOn)
+		if err != nil {
+			return nil, err
+		}
+		deps.Add(group.String, dependsOn)
+	}
+	return deps, rows.Err()
+}
@@ -18,6 +18,7 @@ package database
 
 import (
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
 	"reflect"
 	"testing"
 )
@@ -35,15 +36,29 @@ func TestFillInsertQuery(t *testing.T) {
 		DeleteTemplate:  "DROP TABLE wtf;",
 		Errors:          []string{},
 		CompletedRun:    false,
+		Version:         3,
+		TemplateName:    "example",
+		TemplateTarget:  model.TemplateRuleTargetDevice,
+		Parameters:      map[string]any{"interval": "1 day"},
+		TemplateVersion: 2,
+		DependsOn:       []string{"1"},
 	})
-	if !reflect.DeepEqual(fields, []string{"Id", "Description", "Priority", "Group", "TableRegEx", "Users", "Roles", "CommandTemplate", "DeleteTemplate", "Errors", "CompletedRun"}) {
+	if !reflect.DeepEqual(fields, []string{"Id", "Description", "Priority", "Group", "TableRegEx", "Users", "Roles", "CommandTemplate", "DeleteTemplate", "Errors", "CompletedRun", "Version", "TemplateName", "TemplateTarget", "Parameters", "TemplateVersion", "DependsOn"}) {
 		t.Error("fields not as expected")
 	}
-	if !reflect.DeepEqual(values, []string{"'0'", "'test'", "'1'", "'2'", "'.*'", "'{\"sepl\", \"jürgen\"}'", "'{\"user\", \"admin\"}'", "'CREATE TABLE wtf;'", "'DROP TABLE wtf;'", "'{}'", "FALSE"}) {
+	if !reflect.DeepEqual(values, []string{"'0'", "'test'", "'1'", "'2'", "'.*'", "'{\"sepl\", \"jürgen\"}'", "'{\"user\", \"admin\"}'", "'CREATE TABLE wtf;'", "'DROP TABLE wtf;'", "'{}'", "FALSE", "'3'", "'example'", "'device'", "'{\"interval\":\"1 day\"}'::jsonb", "'2'", "'{\"1\"}'"}) {
 		t.Error("values not as expected")
 	}
 }
 
+func TestFillInsertQueryArrayEscaping(t *testing.T) {
+	_, values := getFieldsAndValues(&templates.Template{DependsOn: []string{`it's`, `a"b`, `c\d`}})
+	expected := `'{"it''s", "a\"b", "c\\d"}'`
+	if values[len(values)-1] != expected {
+		t.Error("unexpected value", values[len(values)-1])
+	}
+}
+
 func BenchmarkFillInsertQuery(b *testing.B) {
 	rule := &model.Rule{
 		Id:              "0",
@@ -61,3 +76,63 @@ func BenchmarkFillInsertQuery(b *testing.B) {
 		getFieldsAndValues(rule)
 	}
 }
+
+func TestRuleListConditions(t *testing.T) {
+	completedRun := true
+	hasErrors := false
+	where, args, err := ruleListConditions(model.RuleListOptions{
+		Group:        "group",
+		User:         "user",
+		Role:         "role",
+		CompletedRun: &completedRun,
+		HasErrors:    &hasErrors,
+		Target:       model.TemplateRuleTargetDevice,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if where != "TRUE AND \"Group\" = $1 AND $2 = ANY(\"Users\") AND $3 = ANY(\"Roles\") AND \"CompletedRun\" = $4 "+
+		"AND NOT cardinality(COALESCE(\"Errors\", '{}')) > 0 AND \"TemplateTarget\" = $5" {
+		t.Error("Unexpected conditions: " + where)
+	}
+	if !reflect.DeepEqual(args, []any{"group", "user", "role", true, "device"}) {
+		t.Error("args not as expected")
+	}
+}
+
+func TestRuleListConditionsType(t *testing.T) {
+	where, args, err := ruleListConditions(model.RuleListOptions{
+		Type:     model.RuleTypeTemplate,
+		Template: "example",
+		Owner:    "user",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if where != "TRUE AND \"Users\" = ARRAY[$1]::text[] AND cardinality(COALESCE(\"Roles\", '{}')) = 0 "+
+		"AND \"TemplateName\" = $2 AND \"TemplateName\" <> ''" {
+		t.Error("Unexpected conditions: " + where)
+	}
+	if !reflect.DeepEqual(args, []any{"user", "example"}) {
+		t.Error("args not as expected")
+	}
+}
+
+func TestJsonColumn(t *testing.T) {
+	var params map[string]any
+	err := jsonColumn{&params}.Scan([]byte(`{"interval": "1 day", "days": 7, "factor": 0.5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(params, map[string]any{"interval": "1 day", "days": int64(7), "factor": 0.5}) {
+		t.Error("params not as expected", params)
+	}
+	params = nil
+	err = jsonColumn{&params}.Scan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != nil {
+		t.Error("expected nil params")
+	}
+}
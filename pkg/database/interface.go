@@ -20,24 +20,55 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
+
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
 )
 
 type DB interface {
 	GetTx() (tx *sql.Tx, cancel context.CancelFunc, err error)
 	InsertRule(rule *model.Rule, tx *sql.Tx) (err error)
 	UpdateRule(rule *model.Rule, tx *sql.Tx) (err error)
+	UpdateRuleStatus(rule *model.Rule, tx *sql.Tx) (err error)
+	UpdateRuleTemplate(rule *model.Rule, tx *sql.Tx) (err error)
 	DeleteRule(id string, tx *sql.Tx) (err error)
 	GetRule(id string, tx *sql.Tx) (rule *model.Rule, err error)
-	ListRules(limit, offset int) (rules []model.Rule, err error)
+	ListRules(options model.RuleListOptions) (rules []model.Rule, total int, err error)
 	FindMatchingTables(ruleIds []string, tx *sql.Tx) (tables []string, err error)
+	FindTablesMatching(regex string, tx *sql.Tx) (tables []string, err error)
 	FindMatchingRules(tables []string, tx *sql.Tx) (rules []model.Rule, err error)
 	FindMatchingRulesWithOwnerInfo(table string, userIds []string, roles []string, limitToRuleIds []string, tx *sql.Tx) (rules []model.Rule, err error)
 	FindDeviceTables(deviceId string) (tables []string, err error)
 	GetColumns(table string) (columns []string, err error)
+	ExistingRelations(names []string, tx *sql.Tx) (existing []string, err error)
 	Exec(query string, tx *sql.Tx) (result sql.Result, err error)
 	Lock() error
 	Unlock() error
+	LockTable(table string, tx *sql.Tx) error
+	LockDependencies(tx *sql.Tx) error
+	ListDependencies(excludeRuleId string, excludeTemplate string, tx *sql.Tx) (deps model.GroupDependencies, err error)
+	AppendRuleError(ruleId string, ruleErr string, tx *sql.Tx) (err error)
+
+	SetApplication(application *model.RuleApplication, tx *sql.Tx) (err error)
+	GetApplication(ruleId string, table string, tx *sql.Tx) (application *model.RuleApplication, err error)
+	DeleteApplication(ruleId string, table string, tx *sql.Tx) (err error)
+	ListApplications(ruleId string, table string) (applications []model.RuleApplication, err error)
+	ListAppliedTables() (tables []string, err error)
+	SetDriftReport(report *model.DriftReport) (err error)
+	GetDriftReport() (report *model.DriftReport, err error)
+	TryLockReconciler() (unlock func(), ok bool, err error)
+
+	InsertJob(job *model.Job, tx *sql.Tx) (err error)
+	UpdateJob(job *model.Job) (err error)
+	GetJob(id string) (job *model.Job, err error)
+	ListJobs(limit, offset int) (jobs []model.Job, err error)
+	ClaimNextJob() (job *model.Job, err error)
+	TouchJob(id string) (err error)
+	RequeueStaleJobs(staleAfter time.Duration) (requeued int64, err error)
+
+	templates.Persistence
 }
 
 var ErrNotFound = errors.New("not found")
+var ErrVersionMismatch = errors.New("version mismatch")
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+)
+
+func (this *impl) jobTable() string {
+	return this.ruleTable + "_jobs"
+}
+
+func (this *impl) InsertJob(job *model.Job, tx *sql.Tx) (err error) {
+	return this.insert(this.jobTable(), job, tx)
+}
+
+func (this *impl) UpdateJob(job *model.Job) (err error) {
+	return this.update(this.jobTable(), job.Id, job, this.sql)
+}
+
+func (this *impl) GetJob(id string) (job *model.Job, err error) {
+	r := this.sql.QueryRow(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" WHERE \"Id\" = $1", this.ruleSchema, this.jobTable()), id)
+	job = &model.Job{}
+	err = scanJob(r, job)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+func (this *impl) ListJobs(limit, offset int) (jobs []model.Job, err error) {
+	rows, err := this.sql.Query(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" ORDER BY \"Created\" DESC LIMIT %d OFFSET %d",
+		this.ruleSchema, this.jobTable(), limit, offset))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs = []model.Job{}
+	for rows.Next() {
+		job := model.Job{}
+		err = scanJob(rows, &job)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimNextJob marks the oldest queued job as running and returns it. Jobs of a rule that already has a running job
+// are skipped. Concurrent instances never claim the same job. Returns ErrNotFound if no job is queued.
+func (this *impl) ClaimNextJob() (job *model.Job, err error) {
+	query := fmt.Sprintf("UPDATE \"%s\".\"%s\" SET \"State\" = $1, \"Started\" = COALESCE(\"Started\", now()), \"Updated\" = now() "+
+		"WHERE \"Id\" = (SELECT \"Id\" FROM \"%s\".\"%s\" queued WHERE \"State\" = $2 "+
+		"AND NOT EXISTS (SELECT 1 FROM \"%s\".\"%s\" running WHERE running.\"State\" = $1 AND running.\"RuleId\" <> '' AND running.\"RuleId\" = queued.\"RuleId\") "+
+		"ORDER BY \"Created\" LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING *;",
+		this.ruleSchema, this.jobTable(), this.ruleSchema, this.jobTable(), this.ruleSchema, this.jobTable())
+	r := this.sql.QueryRow(query, model.JobStateRunning, model.JobStateQueued)
+	job = &model.Job{}
+	err = scanJob(r, job)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// TouchJob updates the heartbeat of a running job.
+func (this *impl) TouchJob(id string) (err error) {
+	_, err = this.sql.Exec(fmt.Sprintf("UPDATE \"%s\".\"%s\" SET \"Updated\" = now() WHERE \"Id\" = $1;", this.ruleSchema, this.jobTable()), id)
+	return err
+}
+
+// RequeueStaleJobs queues running jobs again if their heartbeat is older than staleAfter.
+// This happens if the instance running the job stopped before finishing it.
+func (this *impl) RequeueStaleJobs(staleAfter time.Duration) (requeued int64, err error) {
+	res, err := this.sql.Exec(fmt.Sprintf("UPDATE \"%s\".\"%s\" SET \"State\" = $1 WHERE \"State\" = $2 AND \"Updated\" < $3;",
+		this.ruleSchema, this.jobTable()), model.JobStateQueued, model.JobStateRunning, time.Now().Add(-staleAfter))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
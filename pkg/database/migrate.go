@@ -19,6 +19,7 @@ package database
 import (
 	"database/sql"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
 	"reflect"
 )
 
@@ -35,13 +36,83 @@ func (this *impl) migrate() (err error) {
 		if err != nil {
 			return err
 		}
+
+		query = this.getJobMigrationQuery()
+		_, err = tx.Exec(query)
+		if err != nil {
+			return err
+		}
+
+		query = this.getTemplateMigrationQuery()
+		_, err = tx.Exec(query)
+		if err != nil {
+			return err
+		}
+
+		query = this.getApplicationMigrationQuery()
+		_, err = tx.Exec(query)
+		if err != nil {
+			return err
+		}
+
+		query = this.getCreateTableQuery(this.driftTable(), reflect.TypeOf(model.DriftReport{}))
+		_, err = tx.Exec(query)
+		if err != nil {
+			return err
+		}
 		return nil
 	})
 }
 
 func (this *impl) getMigrationQuery() string {
-	t := reflect.TypeOf(model.Rule{})
-	query := "CREATE TABLE IF NOT EXISTS \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" (\n"
+	query := this.getCreateTableQuery(this.ruleTable, reflect.TypeOf(model.Rule{}))
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"CompletedRun\" boolean not null default false;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"Version\" bigint not null default 1;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"TemplateName\" text not null default '';"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"TemplateTarget\" text not null default '';"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"Parameters\" jsonb;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"TemplateVersion\" bigint not null default 0;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"DependsOn\" text[] not null default '{}';"
+	return query
+}
+
+func (this *impl) getJobMigrationQuery() string {
+	query := this.getCreateTableQuery(this.jobTable(), reflect.TypeOf(model.Job{}))
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.jobTable() + "\" ADD COLUMN IF NOT EXISTS \"Table\" text not null default '';"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.jobTable() + "\" ADD COLUMN IF NOT EXISTS \"Delete\" boolean not null default false;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.jobTable() + "\" ADD COLUMN IF NOT EXISTS \"Template\" text not null default '';"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.jobTable() + "\" ADD COLUMN IF NOT EXISTS \"Checkpoint\" text not null default '';"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.jobTable() + "\" ADD COLUMN IF NOT EXISTS \"PreviousRule\" jsonb;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.jobTable() + "\" ADD COLUMN IF NOT EXISTS \"Results\" jsonb;"
+	return query
+}
+
+func (this *impl) getTemplateMigrationQuery() string {
+	query := this.getCreateTableQuery(this.templateTable(), reflect.TypeOf(templates.Template{}))
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.templateTable() + "\" ADD COLUMN IF NOT EXISTS \"Parameters\" jsonb;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.templateTable() + "\" ADD COLUMN IF NOT EXISTS \"Version\" bigint not null default 1;"
+	// DependsOn was a jsonb column before, the converted column is added last again to keep the order of the columns
+	query += "\nDO $$ BEGIN IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = '" + this.ruleSchema + "' AND table_name = '" + this.templateTable() + "' AND column_name = 'DependsOn' AND data_type = 'jsonb') THEN" +
+		"\n  ALTER TABLE \"" + this.ruleSchema + "\".\"" + this.templateTable() + "\" RENAME COLUMN \"DependsOn\" TO \"DependsOnJson\";" +
+		"\n  ALTER TABLE \"" + this.ruleSchema + "\".\"" + this.templateTable() + "\" ADD COLUMN \"DependsOn\" text[] not null default '{}';" +
+		"\n  UPDATE \"" + this.ruleSchema + "\".\"" + this.templateTable() + "\" SET \"DependsOn\" = ARRAY(SELECT jsonb_array_elements_text(\"DependsOnJson\")) WHERE jsonb_typeof(\"DependsOnJson\") = 'array';" +
+		"\n  ALTER TABLE \"" + this.ruleSchema + "\".\"" + this.templateTable() + "\" DROP COLUMN \"DependsOnJson\";" +
+		"\nEND IF; END $$;"
+	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.templateTable() + "\" ADD COLUMN IF NOT EXISTS \"DependsOn\" text[] not null default '{}';"
+	query += "\n" + this.getCreateTableQuery(this.partialTable(), reflect.TypeOf(templates.Partial{}))
+	return query
+}
+
+func (this *impl) getApplicationMigrationQuery() string {
+	query := this.getCreateTableQuery(this.applicationTable(), reflect.TypeOf(model.RuleApplication{}))
+	query += "\nCREATE UNIQUE INDEX IF NOT EXISTS \"" + this.applicationTable() + "_rule_table\" ON \"" + this.ruleSchema + "\".\"" + this.applicationTable() + "\" (\"RuleId\", \"Table\");"
+	query += "\nCREATE INDEX IF NOT EXISTS \"" + this.applicationTable() + "_table\" ON \"" + this.ruleSchema + "\".\"" + this.applicationTable() + "\" (\"Table\");"
+	return query
+}
+
+// getCreateTableQuery creates a table with a column for each field of t that has a sqltype tag.
+func (this *impl) getCreateTableQuery(table string, t reflect.Type) string {
+	query := "CREATE TABLE IF NOT EXISTS \"" + this.ruleSchema + "\".\"" + table + "\" (\n"
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 		sqlType, ok := field.Tag.Lookup("sqltype")
@@ -60,6 +131,5 @@ func (this *impl) getMigrationQuery() string {
 
 	}
 	query += "\n);"
-	query += "\nALTER TABLE \"" + this.ruleSchema + "\".\"" + this.ruleTable + "\" ADD COLUMN IF NOT EXISTS \"CompletedRun\" boolean not null default false;"
 	return query
 }
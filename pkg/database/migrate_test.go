@@ -35,9 +35,21 @@ func TestQueryString(t *testing.T) {
 			"\"CommandTemplate\" text,\n"+
 			"\"DeleteTemplate\" text,\n"+
 			"\"Errors\" text[],\n"+
-			"\"CompletedRun\" boolean not null default false\n"+
+			"\"CompletedRun\" boolean not null default false,\n"+
+			"\"Version\" bigint not null default 1,\n"+
+			"\"TemplateName\" text not null default '',\n"+
+			"\"TemplateTarget\" text not null default '',\n"+
+			"\"Parameters\" jsonb,\n"+
+			"\"TemplateVersion\" bigint not null default 0,\n"+
+			"\"DependsOn\" text[] not null default '{}'\n"+
 			");\n"+
-			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"CompletedRun\" boolean not null default false;" {
+			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"CompletedRun\" boolean not null default false;\n"+
+			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"Version\" bigint not null default 1;\n"+
+			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"TemplateName\" text not null default '';\n"+
+			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"TemplateTarget\" text not null default '';\n"+
+			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"Parameters\" jsonb;\n"+
+			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"TemplateVersion\" bigint not null default 0;\n"+
+			"ALTER TABLE \"schema\".\"rules\" ADD COLUMN IF NOT EXISTS \"DependsOn\" text[] not null default '{}';" {
 		t.Error("Unexpected result from getMigrationQuery(): " + query)
 	}
 }
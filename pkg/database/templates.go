@@ -0,0 +1,272 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/go-service-base/struct-logger/attributes"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+	"github.com/lib/pq"
+)
+
+func (this *impl) templateTable() string {
+	return this.ruleTable + "_templates"
+}
+
+func (this *impl) partialTable() string {
+	return this.ruleTable + "_partials"
+}
+
+// templateChannel is the channel used to notify all instances of changed templates.
+func (this *impl) templateChannel() string {
+	return this.ruleSchema + "_" + this.templateTable()
+}
+
+func (this *impl) ListTemplates() (list []templates.Template, err error) {
+	rows, err := this.sql.Query(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" ORDER BY \"Name\"", this.ruleSchema, this.templateTable()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list = []templates.Template{}
+	for rows.Next() {
+		tmpl := templates.Template{}
+		err = scanTemplate(rows, &tmpl)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tmpl)
+	}
+	return list, rows.Err()
+}
+
+func (this *impl) GetTemplate(name string) (tmpl *templates.Template, err error) {
+	r := this.sql.QueryRow(fmt.Sprintf("SELECT * FROM \"%s\".\"%s\" WHERE \"Name\" = $1", this.ruleSchema, this.templateTable()), name)
+	tmpl = &templates.Template{}
+	err = scanTemplate(r, tmpl)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func (this *impl) InsertTemplateIfMissing(tmpl templates.Template) (err error) {
+	return this.withTx(func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM \"%s\".\"%s\" WHERE \"Name\" = $1)", this.ruleSchema, this.templateTable()), tmpl.Name).Scan(&exists)
+		if err != nil || exists {
+			return err
+		}
+		err = this.insert(this.templateTable(), &tmpl, tx)
+		if err != nil {
+			return err
+		}
+		return this.notifyTemplateChange(tmpl.Name, tx)
+	})
+}
+
+// SetTemplate creates or replaces the template and returns the stored template. The version is incremented by the
+// database if the template changed, but never lowered below the version of tmpl, so that concurrent instances never
+// store different templates with the same version.
+func (this *impl) SetTemplate(tmpl templates.Template) (stored templates.Template, err error) {
+	fields, values := getFieldsAndValues(&tmpl)
+	columns := []string{}
+	changes := []string{}
+	current := []string{}
+	excluded := []string{}
+	for _, field := range fields {
+		columns = append(columns, "\""+field+"\"")
+		if field == "Name" || field == "Version" {
+			continue
+		}
+		changes = append(changes, "\""+field+"\" = EXCLUDED.\""+field+"\"")
+		current = append(current, "t.\""+field+"\"")
+		excluded = append(excluded, "EXCLUDED.\""+field+"\"")
+	}
+	query := fmt.Sprintf("INSERT INTO \"%s\".\"%s\" AS t (%s) VALUES (%s) ON CONFLICT (\"Name\") DO UPDATE SET %s, "+
+		"\"Version\" = CASE WHEN (%s) IS NOT DISTINCT FROM (%s) THEN t.\"Version\" ELSE GREATEST(EXCLUDED.\"Version\", t.\"Version\" + 1) END RETURNING *",
+		this.ruleSchema, this.templateTable(), strings.Join(columns, ", "), strings.Join(values, ", "), strings.Join(changes, ", "),
+		strings.Join(current, ", "), strings.Join(excluded, ", "))
+	err = this.withTx(func(tx *sql.Tx) error {
+		err := scanTemplate(tx.QueryRow(query), &stored)
+		if err != nil {
+			return err
+		}
+		return this.notifyTemplateChange(tmpl.Name, tx)
+	})
+	return stored, err
+}
+
+// CreateTemplate inserts the template. Returns templates.ErrTemplateExists if a template with the same name exists.
+func (this *impl) CreateTemplate(tmpl templates.Template) (err error) {
+	fields, values := getFieldsAndValues(&tmpl)
+	columns := []string{}
+	for _, field := range fields {
+		columns = append(columns, "\""+field+"\"")
+	}
+	query := fmt.Sprintf("INSERT INTO \"%s\".\"%s\" (%s) VALUES (%s) ON CONFLICT (\"Name\") DO NOTHING",
+		this.ruleSchema, this.templateTable(), strings.Join(columns, ", "), strings.Join(values, ", "))
+	return this.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return templates.ErrTemplateExists
+		}
+		return this.notifyTemplateChange(tmpl.Name, tx)
+	})
+}
+
+// UpdateTemplate replaces the template and returns the stored template. The version is incremented like in
+// SetTemplate. Returns templates.ErrTemplateNotFound if the template does not exist.
+func (this *impl) UpdateTemplate(tmpl templates.Template) (stored templates.Template, err error) {
+	fields, values := getFieldsAndValues(&tmpl)
+	changes := []string{}
+	current := []string{}
+	updated := []string{}
+	version := ""
+	for i, field := range fields {
+		switch field {
+		case "Name":
+			continue
+		case "Version":
+			version = values[i]
+			continue
+		}
+		changes = append(changes, "\""+field+"\" = "+values[i])
+		current = append(current, "\""+field+"\"")
+		updated = append(updated, values[i])
+	}
+	query := fmt.Sprintf("UPDATE \"%s\".\"%s\" SET %s, "+
+		"\"Version\" = CASE WHEN (%s) IS NOT DISTINCT FROM (%s) THEN \"Version\" ELSE GREATEST(%s, \"Version\" + 1) END WHERE \"Name\" = $1 RETURNING *",
+		this.ruleSchema, this.templateTable(), strings.Join(changes, ", "),
+		strings.Join(current, ", "), strings.Join(updated, ", "), version)
+	err = this.withTx(func(tx *sql.Tx) error {
+		err := scanTemplate(tx.QueryRow(query, tmpl.Name), &stored)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return templates.ErrTemplateNotFound
+			}
+			return err
+		}
+		return this.notifyTemplateChange(tmpl.Name, tx)
+	})
+	return stored, err
+}
+
+func (this *impl) DeleteTemplate(name string) (err error) {
+	return this.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(fmt.Sprintf("DELETE FROM \"%s\".\"%s\" WHERE \"Name\" = $1", this.ruleSchema, this.templateTable()), name)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return templates.ErrTemplateNotFound
+		}
+		return this.notifyTemplateChange(name, tx)
+	})
+}
+
+func (this *impl) ListPartials() (list []templates.Partial, err error) {
+	rows, err := this.sql.Query(fmt.Sprintf("SELECT \"Name\", \"Template\" FROM \"%s\".\"%s\" ORDER BY \"Name\"", this.ruleSchema, this.partialTable()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list = []templates.Partial{}
+	for rows.Next() {
+		partial := templates.Partial{}
+		err = rows.Scan(&partial.Name, &partial.Template)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, partial)
+	}
+	return list, rows.Err()
+}
+
+func (this *impl) InsertPartialIfMissing(partial templates.Partial) (err error) {
+	return this.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(fmt.Sprintf("INSERT INTO \"%s\".\"%s\" (\"Name\", \"Template\") VALUES ($1, $2) ON CONFLICT DO NOTHING", this.ruleSchema, this.partialTable()), partial.Name, partial.Template)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+		return this.notifyTemplateChange(templates.PartialsDir+"/"+partial.Name, tx)
+	})
+}
+
+// notifyTemplateChange announces the change to all listeners once tx is committed.
+func (this *impl) notifyTemplateChange(name string, tx *sql.Tx) error {
+	_, err := tx.Exec("SELECT pg_notify($1, $2)", this.templateChannel(), name)
+	return err
+}
+
+func (this *impl) ListenTemplateChanges(ctx context.Context, wg *sync.WaitGroup, onChange func(name string)) (err error) {
+	listener := pq.NewListener(this.connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Logger.Error("template listener error", attributes.ErrorKey, err)
+		}
+	})
+	err = listener.Listen(this.templateChannel())
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				if n == nil {
+					// connection was re-established, notifications might have been lost
+					onChange("")
+					continue
+				}
+				onChange(n.Extra)
+			}
+		}
+	}()
+	return nil
+}
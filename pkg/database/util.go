@@ -17,11 +17,14 @@
 package database
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/model"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
 	"github.com/lib/pq"
 	"reflect"
 	"strings"
@@ -50,8 +53,8 @@ type queryable interface {
 	Query(query string, args ...any) (*sql.Rows, error)
 }
 
-func (this *impl) queryStrings(query string, tx queryable) (result []string, err error) {
-	rows, err := tx.Query(query)
+func (this *impl) queryStrings(query string, tx queryable, args ...any) (result []string, err error) {
+	rows, err := tx.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -67,20 +70,24 @@ func (this *impl) queryStrings(query string, tx queryable) (result []string, err
 	return result, nil
 }
 
-func getFieldsAndValues(rule *model.Rule) (fields []string, values []string) {
+func getFieldsAndValues(value any) (fields []string, values []string) {
 	fields = []string{}
 	values = []string{}
-	t := reflect.TypeOf(*rule)
-	v := reflect.ValueOf(*rule)
+	v := reflect.Indirect(reflect.ValueOf(value))
+	t := v.Type()
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		_, ok := field.Tag.Lookup("sqltype")
+		sqlType, ok := field.Tag.Lookup("sqltype")
 		if !ok {
 			continue
 		}
 		fields = append(fields, field.Name)
 		fv := v.FieldByName(field.Name)
 		value := ""
+		if sqlType == "jsonb" {
+			values = append(values, getJsonValue(fv))
+			continue
+		}
 		switch fv.Interface().(type) {
 		case string:
 			value = fmt.Sprintf("'%s'", strings.ReplaceAll(fv.String(), "'", "''"))
@@ -95,7 +102,9 @@ func getFieldsAndValues(rule *model.Rule) (fields []string, values []string) {
 				if j > 0 {
 					value += ", "
 				}
-				value += "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\""
+				s = strings.ReplaceAll(s, "\\", "\\\\")
+				s = strings.ReplaceAll(s, "\"", "\\\"")
+				value += "\"" + strings.ReplaceAll(s, "'", "''") + "\""
 			}
 			value += "}'"
 		case *bool:
@@ -114,6 +123,15 @@ func getFieldsAndValues(rule *model.Rule) (fields []string, values []string) {
 			} else {
 				value = "FALSE"
 			}
+		case time.Time:
+			value = "'" + fv.Interface().(time.Time).Format(time.RFC3339Nano) + "'"
+		case *time.Time:
+			ts := fv.Interface().(*time.Time)
+			if ts == nil {
+				value = "NULL"
+			} else {
+				value = "'" + ts.Format(time.RFC3339Nano) + "'"
+			}
 		default:
 			value = "NULL"
 		}
@@ -122,16 +140,158 @@ func getFieldsAndValues(rule *model.Rule) (fields []string, values []string) {
 	return fields, values
 }
 
+// getJsonValue encodes maps, slices and structs for jsonb columns. Nil maps and slices are stored as NULL.
+func getJsonValue(fv reflect.Value) string {
+	if (fv.Kind() == reflect.Map || fv.Kind() == reflect.Slice || fv.Kind() == reflect.Pointer) && fv.IsNil() {
+		return "NULL"
+	}
+	b, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return "NULL"
+	}
+	return "'" + strings.ReplaceAll(string(b), "'", "''") + "'::jsonb"
+}
+
+// jsonColumn scans a nullable jsonb column into dest.
+// Numbers in maps and in the parameters of rules are decoded as int64 if they are integral and as float64 otherwise.
+type jsonColumn struct {
+	dest any
+}
+
+func (this jsonColumn) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("unsupported type %T for jsonb column", src)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	err := decoder.Decode(this.dest)
+	if err != nil {
+		return err
+	}
+	if m, ok := this.dest.(*map[string]any); ok && *m != nil {
+		for k, v := range *m {
+			(*m)[k] = normalizeNumber(v)
+		}
+	}
+	if rule, ok := this.dest.(**model.Rule); ok && *rule != nil {
+		for k, v := range (*rule).Parameters {
+			(*rule).Parameters[k] = normalizeNumber(v)
+		}
+	}
+	return nil
+}
+
+func normalizeNumber(v any) any {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+	case []any:
+		for i := range n {
+			n[i] = normalizeNumber(n[i])
+		}
+	case map[string]any:
+		for k := range n {
+			n[k] = normalizeNumber(n[k])
+		}
+	}
+	return v
+}
+
 type scannable interface {
 	Scan(dest ...any) error
 }
 
+type execable interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (this *impl) insert(table string, value any, tx execable) (err error) {
+	query := fmt.Sprintf("INSERT INTO \"%s\".\"%s\" (", this.ruleSchema, table)
+	fields, values := getFieldsAndValues(value)
+	valueStr := "VALUES ("
+	for i := range fields {
+		if i > 0 {
+			query += ", "
+			valueStr += ", "
+		}
+		query += "\"" + fields[i] + "\""
+		valueStr += values[i]
+	}
+	valueStr += ")"
+	query += ") " + valueStr + ";"
+	_, err = tx.Exec(query)
+	return err
+}
+
+func (this *impl) update(table string, id string, value any, tx execable) (err error) {
+	return this.updateWithCondition(table, id, value, "", tx)
+}
+
+// updateWithCondition updates the row with the given id only if the additional condition holds.
+// Returns ErrNotFound if no row was updated.
+func (this *impl) updateWithCondition(table string, id string, value any, condition string, tx execable) (err error) {
+	query := fmt.Sprintf("UPDATE \"%s\".\"%s\" SET ", this.ruleSchema, table)
+	fields, values := getFieldsAndValues(value)
+	for i := range fields {
+		if i > 0 {
+			query += ", "
+		}
+		query += "\"" + fields[i] + "\" = " + values[i]
+	}
+	query += " WHERE \"Id\" = $1"
+	if len(condition) > 0 {
+		query += " AND " + condition
+	}
+	query += ";"
+	res, err := tx.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func scan(r scannable, rule *model.Rule, other ...any) error {
 	if other == nil {
 		other = []interface{}{}
 	}
 	other = append(other, &rule.Id, &rule.Description, &rule.Priority, &rule.Group, &rule.TableRegEx,
 		(*pq.StringArray)(&rule.Users), (*pq.StringArray)(&rule.Roles), &rule.CommandTemplate, &rule.DeleteTemplate,
-		(*pq.StringArray)(&rule.Errors), &rule.CompletedRun)
+		(*pq.StringArray)(&rule.Errors), &rule.CompletedRun, &rule.Version,
+		&rule.TemplateName, &rule.TemplateTarget, jsonColumn{&rule.Parameters}, &rule.TemplateVersion, (*pq.StringArray)(&rule.DependsOn))
 	return r.Scan(other...)
 }
+
+func scanTemplate(r scannable, tmpl *templates.Template) error {
+	return r.Scan(&tmpl.Name, &tmpl.CommandTemplate, &tmpl.DeleteTemplate, &tmpl.Description, &tmpl.Priority, &tmpl.Group, jsonColumn{&tmpl.Parameters}, &tmpl.Version, (*pq.StringArray)(&tmpl.DependsOn))
+}
+
+func scanApplication(r scannable, application *model.RuleApplication) error {
+	return r.Scan(&application.RuleId, &application.Table, &application.Group, &application.RuleVersion, &application.CommandHash,
+		&application.DeleteSql, &application.Applied)
+}
+
+func scanJob(r scannable, job *model.Job) error {
+	return r.Scan(&job.Id, &job.Type, &job.RuleId, &job.State, &job.Created, &job.Started, &job.Ended, &job.Updated,
+		&job.TablesProcessed, &job.TablesTotal, &job.RequestId, &job.Error, &job.Table, &job.Delete, &job.Template, &job.Checkpoint,
+		jsonColumn{&job.PreviousRule}, jsonColumn{&job.Results})
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import "time"
+
+// RuleApplication records that the command template of a rule has been applied to a table.
+// It is removed once the delete template of the rule has been applied to the table.
+type RuleApplication struct {
+	RuleId      string    `sqltype:"text" sqlextra:"not null" json:"rule_id"`
+	Table       string    `sqltype:"text" sqlextra:"not null" json:"table"`
+	Group       string    `sqltype:"text" json:"group"`
+	RuleVersion int64     `sqltype:"bigint" json:"rule_version"`
+	CommandHash string    `sqltype:"text" json:"command_hash"` // hex encoded SHA-256 of the rendered command template
+	DeleteSql   string    `sqltype:"text" json:"delete_sql"`   // rendered delete template, used instead of rendering the delete template again
+	Applied     time.Time `sqltype:"timestamptz" json:"applied"`
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// RuleBundleVersion is the format version of exported rule bundles.
+const RuleBundleVersion = 1
+
+// RuleBundle is the exported rule set. Only the definition of each rule is exported, status fields are empty.
+type RuleBundle struct {
+	Version  int       `json:"version"`
+	Exported time.Time `json:"exported"`
+	Rules    []Rule    `json:"rules"`
+}
+
+func (bundle RuleBundle) Validate() error {
+	if bundle.Version != RuleBundleVersion {
+		return errors.New("unsupported bundle version " + strconv.Itoa(bundle.Version))
+	}
+	return nil
+}
+
+// RuleBundleWriter encodes a RuleBundle rule by rule as JSON or YAML, so that exports don't have to hold all rules
+// in memory. Nothing is written before the first rule or Close.
+type RuleBundleWriter struct {
+	w        io.Writer
+	yaml     bool
+	exported time.Time
+	rules    int
+}
+
+func NewRuleBundleWriter(w io.Writer, yaml bool, exported time.Time) *RuleBundleWriter {
+	return &RuleBundleWriter{w: w, yaml: yaml, exported: exported, rules: -1}
+}
+
+func (this *RuleBundleWriter) writeHeader() error {
+	exported, err := json.Marshal(this.exported)
+	if err != nil {
+		return err
+	}
+	header := `{"version":` + strconv.Itoa(RuleBundleVersion) + `,"exported":` + string(exported) + `,"rules":[`
+	if this.yaml {
+		header = "version: " + strconv.Itoa(RuleBundleVersion) + "\nexported: " + string(exported) + "\nrules:"
+	}
+	_, err = io.WriteString(this.w, header)
+	this.rules = 0
+	return err
+}
+
+// Write encodes the rule as next rule of the bundle.
+func (this *RuleBundleWriter) Write(rule Rule) (err error) {
+	if this.rules < 0 {
+		err = this.writeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	var b []byte
+	if this.yaml {
+		b, err = yaml.Marshal([]Rule{rule})
+		b = append([]byte("\n"), b[:max(len(b)-1, 0)]...)
+	} else {
+		b, err = json.Marshal(rule)
+		if this.rules > 0 {
+			b = append([]byte(","), b...)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = this.w.Write(b)
+	this.rules++
+	return err
+}
+
+// Close completes the bundle.
+func (this *RuleBundleWriter) Close() error {
+	if this.rules < 0 {
+		err := this.writeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	footer := "]}\n"
+	if this.yaml {
+		footer = "\n"
+		if this.rules == 0 {
+			footer = " []\n"
+		}
+	}
+	_, err := io.WriteString(this.w, footer)
+	return err
+}
+
+type RuleImportMode = string
+
+const RuleImportModeCreateOnly RuleImportMode = "create-only" // rules with an existing id are skipped
+const RuleImportModeUpsert RuleImportMode = "upsert"          // rules with an existing id are updated
+const RuleImportModeReplace RuleImportMode = "replace"        // like upsert, but rules missing in the bundle are deleted
+
+type RuleImportOptions struct {
+	Mode   RuleImportMode
+	DryRun bool
+}
+
+func (options RuleImportOptions) Validate() error {
+	switch options.Mode {
+	case RuleImportModeCreateOnly, RuleImportModeUpsert, RuleImportModeReplace:
+		return nil
+	default:
+		return errors.New("unknown import mode " + options.Mode)
+	}
+}
+
+type RuleImportAction = string
+
+const RuleImportActionCreate RuleImportAction = "create"
+const RuleImportActionUpdate RuleImportAction = "update"
+const RuleImportActionDelete RuleImportAction = "delete"
+const RuleImportActionSkip RuleImportAction = "skip"
+
+type RuleImportResult struct {
+	Id     string           `json:"id"`
+	Action RuleImportAction `json:"action"`
+	Error  string           `json:"error,omitempty"`
+	JobId  string           `json:"job_id,omitempty"` // Set if the rule was created or updated
+}
+
+type RuleImportReport struct {
+	DryRun  bool               `json:"dry_run"`
+	Applied bool               `json:"applied"` // false if the import was a dry run or any rule of the bundle is invalid
+	Results []RuleImportResult `json:"results"`
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestRuleBundleWriter(t *testing.T) {
+	exported := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	rules := []Rule{
+		{Id: "a", Group: "g", TableRegEx: ".*", Users: []string{"u"}, CommandTemplate: "SELECT 1;\nSELECT 2;", DependsOn: []string{"h"}},
+		{Id: "b", Group: "h", TableRegEx: "^x$", Roles: []string{"admin"}, DeleteTemplate: "SELECT 'it''s';", Parameters: map[string]any{"n": float64(1)}},
+	}
+	for _, asYaml := range []bool{false, true} {
+		for n := range len(rules) + 1 {
+			buf := &bytes.Buffer{}
+			writer := NewRuleBundleWriter(buf, asYaml, exported)
+			for _, rule := range rules[:n] {
+				err := writer.Write(rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bundle := RuleBundle{}
+			if asYaml {
+				err = yaml.Unmarshal(buf.Bytes(), &bundle)
+			} else {
+				err = json.Unmarshal(buf.Bytes(), &bundle)
+			}
+			if err != nil {
+				t.Fatal(asYaml, n, err, buf.String())
+			}
+			expected := RuleBundle{Version: RuleBundleVersion, Exported: exported, Rules: append([]Rule{}, rules[:n]...)}
+			if !reflect.DeepEqual(bundle, expected) {
+				t.Errorf("yaml %v, %v rules: unexpected bundle %#v\n%v", asYaml, n, bundle, buf.String())
+			}
+		}
+	}
+}
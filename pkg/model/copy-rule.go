@@ -28,7 +28,11 @@ func (rule *Rule) Copy() Rule {
 		CommandTemplate: rule.CommandTemplate,
 		DeleteTemplate:  rule.DeleteTemplate,
 		//Errors:          rule.Errors,
-		CompletedRun: rule.CompletedRun,
+		CompletedRun:    rule.CompletedRun,
+		Version:         rule.Version,
+		TemplateName:    rule.TemplateName,
+		TemplateTarget:  rule.TemplateTarget,
+		TemplateVersion: rule.TemplateVersion,
 	}
 	if rule.Users != nil {
 		myRule.Users = []string{}
@@ -38,6 +42,16 @@ func (rule *Rule) Copy() Rule {
 		myRule.Roles = []string{}
 		myRule.Roles = append(myRule.Roles, rule.Roles...)
 	}
+	if rule.Parameters != nil {
+		myRule.Parameters = map[string]any{}
+		for k, v := range rule.Parameters {
+			myRule.Parameters[k] = v
+		}
+	}
+	if rule.DependsOn != nil {
+		myRule.DependsOn = []string{}
+		myRule.DependsOn = append(myRule.DependsOn, rule.DependsOn...)
+	}
 	if rule.Errors != nil {
 		myRule.Errors = []string{}
 		myRule.Errors = append(myRule.Errors, rule.Errors...)
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// GroupDependencies maps each group to the groups it depends on.
+type GroupDependencies map[string][]string
+
+// Add records that group depends on each of dependsOn.
+func (deps GroupDependencies) Add(group string, dependsOn []string) {
+	for _, dependency := range dependsOn {
+		if !slices.Contains(deps[group], dependency) {
+			deps[group] = append(deps[group], dependency)
+		}
+	}
+}
+
+// Cycle returns an error naming the groups of a dependency cycle, if there is any.
+func (deps GroupDependencies) Cycle() error {
+	groups := make([]string, 0, len(deps))
+	for group := range deps {
+		groups = append(groups, group)
+	}
+	slices.Sort(groups) // deterministic error messages
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	path := []string{}
+	var visit func(group string) []string
+	visit = func(group string) []string {
+		switch state[group] {
+		case done:
+			return nil
+		case visiting:
+			return append(path[slices.Index(path, group):], group)
+		}
+		state[group] = visiting
+		path = append(path, group)
+		for _, dependency := range deps[group] {
+			if cycle := visit(dependency); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[group] = done
+		return nil
+	}
+	for _, group := range groups {
+		if cycle := visit(group); cycle != nil {
+			return errors.New("dependency cycle between groups " + strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+// SortByDependencies orders the rules so that each rule follows the rules of the groups it depends on.
+// Otherwise, the given order is kept. Dependencies on groups without a rule in rules are ignored.
+func SortByDependencies(rules []Rule) ([]Rule, error) {
+	pendingGroups := map[string]int{} // number of rules per group not sorted yet
+	for _, rule := range rules {
+		pendingGroups[rule.Group]++
+	}
+	sorted := make([]Rule, 0, len(rules))
+	pending := slices.Clone(rules)
+	for len(pending) > 0 {
+		next := slices.IndexFunc(pending, func(rule Rule) bool {
+			return !slices.ContainsFunc(rule.DependsOn, func(dependency string) bool {
+				return pendingGroups[dependency] > 0
+			})
+		})
+		if next < 0 {
+			deps := GroupDependencies{}
+			for _, rule := range pending {
+				deps.Add(rule.Group, rule.DependsOn)
+			}
+			return nil, deps.Cycle()
+		}
+		pendingGroups[pending[next].Group]--
+		sorted = append(sorted, pending[next])
+		pending = slices.Delete(pending, next, next+1)
+	}
+	return sorted, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func groups(rules []Rule) []string {
+	result := []string{}
+	for _, rule := range rules {
+		result = append(result, rule.Group)
+	}
+	return result
+}
+
+func TestSortByDependencies(t *testing.T) {
+	rules := []Rule{
+		{Group: "a_retention", DependsOn: []string{"b_aggregate"}},
+		{Group: "b_aggregate", DependsOn: []string{"c_hypertable"}},
+		{Group: "c_hypertable"},
+		{Group: "d_compression", DependsOn: []string{"missing"}},
+	}
+	sorted, err := SortByDependencies(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"c_hypertable", "b_aggregate", "a_retention", "d_compression"}
+	if !slices.Equal(groups(sorted), expected) {
+		t.Error("unexpected order", groups(sorted))
+	}
+	if !slices.Equal(groups(rules), []string{"a_retention", "b_aggregate", "c_hypertable", "d_compression"}) {
+		t.Error("input modified", groups(rules))
+	}
+
+	_, err = SortByDependencies([]Rule{
+		{Group: "a", DependsOn: []string{"b"}},
+		{Group: "b", DependsOn: []string{"a"}},
+		{Group: "c"},
+	})
+	if err == nil || err.Error() != "dependency cycle between groups a -> b -> a" {
+		t.Error("expected cycle error, got", err)
+	}
+}
+
+func TestGroupDependenciesCycle(t *testing.T) {
+	deps := GroupDependencies{}
+	deps.Add("a", []string{"b", "c"})
+	deps.Add("b", []string{"c"})
+	if err := deps.Cycle(); err != nil {
+		t.Error(err)
+	}
+	deps.Add("c", []string{"c"})
+	if err := deps.Cycle(); err == nil || err.Error() != "dependency cycle between groups c -> c" {
+		t.Error("expected cycle error, got", err)
+	}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import "time"
+
+type DriftKind = string
+
+const DriftKindMissing DriftKind = "missing"                // the rule applies to the table, but no application is recorded
+const DriftKindOutdated DriftKind = "outdated"              // the command of the rule renders differently than when it was applied
+const DriftKindOrphaned DriftKind = "orphaned"              // an application is recorded, but the rule does not apply to the table anymore
+const DriftKindObjectsMissing DriftKind = "objects_missing" // relations created by the command of the rule do not exist anymore
+
+// Drift is a difference between the rules applying to a table, the recorded applications and the catalog.
+type Drift struct {
+	Table  string    `json:"table"`
+	RuleId string    `json:"rule_id"`
+	Group  string    `json:"group"`
+	Kind   DriftKind `json:"kind"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// DriftReport is the result of a reconciliation run. Only the report of the last run is saved.
+type DriftReport struct {
+	Started       time.Time `sqltype:"timestamptz" json:"started"`
+	Finished      time.Time `sqltype:"timestamptz" json:"finished"`
+	TablesChecked int       `sqltype:"integer" json:"tables_checked"`
+	Drift         []Drift   `sqltype:"jsonb" json:"drift"`
+	Reapplied     []string  `sqltype:"jsonb" json:"reapplied"` // tables all rules have been applied to again
+	Errors        []string  `sqltype:"jsonb" json:"errors"`    // tables that could not be checked or applied again
+}
@@ -26,6 +26,9 @@ var ErrBadRequest = errors.New("bad request")
 var ErrInternalServerError = errors.New("internal server error")
 var ErrForbidden = fmt.Errorf("forbidden")
 var ErrNotFound = fmt.Errorf("not found")
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrConflict = errors.New("conflict")
+var ErrPreconditionFailed = errors.New("precondition failed")
 
 func GetStatusCode(err error) int {
 	if err == nil {
@@ -43,6 +46,15 @@ func GetStatusCode(err error) int {
 	if errors.Is(err, ErrForbidden) {
 		return http.StatusForbidden
 	}
+	if errors.Is(err, ErrUnauthorized) {
+		return http.StatusUnauthorized
+	}
+	if errors.Is(err, ErrConflict) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, ErrPreconditionFailed) {
+		return http.StatusPreconditionFailed
+	}
 	return http.StatusInternalServerError
 }
 
@@ -58,6 +70,12 @@ func GetError(code int) error {
 		return ErrNotFound
 	case http.StatusForbidden:
 		return ErrForbidden
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
 	default:
 		return ErrInternalServerError
 	}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import "time"
+
+type JobState = string
+
+const JobStateQueued JobState = "queued"
+const JobStateRunning JobState = "running"
+const JobStateSucceeded JobState = "succeeded"
+const JobStateFailed JobState = "failed"
+
+type JobType = string
+
+const JobTypeRunRule JobType = "run_rule"
+const JobTypeApplyTable JobType = "apply_table"
+const JobTypeApplyAll JobType = "apply_all"
+const JobTypeUpgradeTemplate JobType = "upgrade_template"
+const JobTypeUpdateRule JobType = "update_rule"
+
+type TableAction = string
+
+const TableActionApply TableAction = "apply"     // command template of the rule run
+const TableActionDelete TableAction = "delete"   // delete template of the previous version run
+const TableActionReplace TableAction = "replace" // delete template of the previous version run, then command template of the rule
+
+// TableResult is the outcome of a job for a single table.
+type TableResult struct {
+	Table  string      `json:"table"`
+	Action TableAction `json:"action"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type Job struct {
+	Id              string        `sqltype:"text" sqlextra:"primary key" json:"id"`
+	Type            JobType       `sqltype:"text" json:"type"`
+	RuleId          string        `sqltype:"text" json:"rule_id,omitempty"`
+	State           JobState      `sqltype:"text" json:"state"`
+	Created         time.Time     `sqltype:"timestamptz" json:"created"`
+	Started         *time.Time    `sqltype:"timestamptz" json:"started,omitempty"`
+	Ended           *time.Time    `sqltype:"timestamptz" json:"ended,omitempty"`
+	Updated         time.Time     `sqltype:"timestamptz" json:"updated"` // heartbeat of the instance running the job
+	TablesProcessed int           `sqltype:"integer" json:"tables_processed"`
+	TablesTotal     int           `sqltype:"integer" json:"tables_total"`
+	RequestId       string        `sqltype:"text" json:"request_id,omitempty"`
+	Error           string        `sqltype:"text" json:"error,omitempty"`
+	Table           string        `sqltype:"text" sqlextra:"not null default ''" json:"table,omitempty"`      // set for JobTypeApplyTable
+	Delete          bool          `sqltype:"boolean" sqlextra:"not null default false" json:"delete"`         // run delete templates instead of command templates
+	Template        string        `sqltype:"text" sqlextra:"not null default ''" json:"template,omitempty"`   // set for JobTypeUpgradeTemplate
+	Checkpoint      string        `sqltype:"text" sqlextra:"not null default ''" json:"checkpoint,omitempty"` // set for JobTypeApplyAll, the last table done in order of the table names
+	PreviousRule    *Rule         `sqltype:"jsonb" json:"previous_rule,omitempty"`                            // set for JobTypeUpdateRule, the version replaced by the update
+	Results         []TableResult `sqltype:"jsonb" json:"results,omitempty"`                                  // set for JobTypeUpdateRule, and for JobTypeApplyAll with the tables that failed
+}
@@ -16,18 +16,31 @@
 
 package model
 
+import (
+	"errors"
+	"slices"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+)
+
 type Rule struct {
-	Id              string   `sqltype:"text" sqlextra:"primary key" json:"id,omitempty"` // Set by API
-	Description     string   `sqltype:"text" json:"description,omitempty"`
-	Priority        int      `sqltype:"integer" json:"priority"`
-	Group           string   `sqltype:"text" json:"group,omitempty"`
-	TableRegEx      string   `sqltype:"text" json:"table_reg_ex,omitempty"`
-	Users           []string `sqltype:"text[]" json:"users,omitempty"`
-	Roles           []string `sqltype:"text[]" json:"roles,omitempty"`
-	CommandTemplate string   `sqltype:"text" json:"command_template,omitempty"`
-	DeleteTemplate  string   `sqltype:"text" json:"delete_template,omitempty"`
-	Errors          []string `sqltype:"text[]" json:"errors,omitempty"`
-	CompletedRun    bool     `sqltype:"boolean" sqlextra:"not null default false" json:"completed_run"`
+	Id              string         `sqltype:"text" sqlextra:"primary key" json:"id,omitempty"` // Set by API
+	Description     string         `sqltype:"text" json:"description,omitempty"`
+	Priority        int            `sqltype:"integer" json:"priority"`
+	Group           string         `sqltype:"text" json:"group,omitempty"`
+	TableRegEx      string         `sqltype:"text" json:"table_reg_ex,omitempty"`
+	Users           []string       `sqltype:"text[]" json:"users,omitempty"`
+	Roles           []string       `sqltype:"text[]" json:"roles,omitempty"`
+	CommandTemplate string         `sqltype:"text" json:"command_template,omitempty"`
+	DeleteTemplate  string         `sqltype:"text" json:"delete_template,omitempty"`
+	Errors          []string       `sqltype:"text[]" json:"errors,omitempty"`
+	CompletedRun    bool           `sqltype:"boolean" sqlextra:"not null default false" json:"completed_run"`
+	Version         int64          `sqltype:"bigint" sqlextra:"not null default 1" json:"version,omitempty"`          // Set by API, incremented on each update
+	TemplateName    string         `sqltype:"text" sqlextra:"not null default ''" json:"template_name,omitempty"`     // Set if the rule was created from a template
+	TemplateTarget  string         `sqltype:"text" sqlextra:"not null default ''" json:"template_target,omitempty"`   // Set if the rule was created from a template
+	Parameters      map[string]any `sqltype:"jsonb" json:"parameters,omitempty"`                                      // Parameter values of template rules, available as .Params in templates
+	TemplateVersion int64          `sqltype:"bigint" sqlextra:"not null default 0" json:"template_version,omitempty"` // Version of the template the rule was created from
+	DependsOn       []string       `sqltype:"text[]" sqlextra:"not null default '{}'" json:"depends_on,omitempty"`    // Groups applied before and deleted after the group of this rule
 }
 
 type TypedRule struct {
@@ -35,6 +48,7 @@ type TypedRule struct {
 	Type     RuleType           `json:"type"`
 	Template string             `json:"template"`
 	Target   TemplateRuleTarget `json:"target,omitempty"`
+	JobId    string             `json:"job_id,omitempty"` // Set if the request started a job
 }
 
 type RuleType = string
@@ -44,28 +58,125 @@ const RuleTypeTemplate = "template"
 
 type TemplateRuleTarget = string
 
-const TemplateRuleTargetDevice TemplateRuleTarget = "device"
-const TemplateRuleTargetExport TemplateRuleTarget = "export"
+// Built-in targets, more can be configured, see templates.Target
+const TemplateRuleTargetDevice TemplateRuleTarget = templates.TargetDevice
+const TemplateRuleTargetExport TemplateRuleTarget = templates.TargetExport
 
 type TemplateRule struct {
-	Id       string             `json:"id,omitempty"` // Set by API
-	Target   TemplateRuleTarget `json:"target,omitempty"`
-	Users    []string           `json:"users,omitempty"`
-	Roles    []string           `json:"roles,omitempty"`
-	Template string             `json:"template,omitempty"`
+	Id              string             `json:"id,omitempty"` // Set by API
+	Target          TemplateRuleTarget `json:"target,omitempty"`
+	Users           []string           `json:"users,omitempty"`
+	Roles           []string           `json:"roles,omitempty"`
+	Template        string             `json:"template,omitempty"`
+	Parameters      map[string]any     `json:"parameters,omitempty"`       // Validated against the parameters declared by the template
+	TemplateVersion int64              `json:"template_version,omitempty"` // Set by API
+	Version         int64              `json:"version,omitempty"`          // Version of the underlying rule, see Rule.Version
+	Errors          []string           `json:"errors,omitempty"`           // Set by API
+	CompletedRun    bool               `json:"completed_run"`              // Set by API
+}
+
+type RuleListOptions struct {
+	Limit                 int
+	Offset                int
+	Group                 string
+	Type                  RuleType
+	Template              string
+	Target                TemplateRuleTarget
+	User                  string
+	Role                  string
+	Owner                 string // only rules applying to this user and nobody else
+	TemplateVersionBefore int64  // only rules created from a template version lower than this
+	CompletedRun          *bool
+	HasErrors             *bool
+	Sort                  string // one of RuleSortFields, defaults to id
+	Order                 string // asc or desc, defaults to asc
+}
+
+var RuleSortFields = []string{"id", "description", "priority", "group", "table_reg_ex", "completed_run"}
+
+func (options RuleListOptions) Validate() error {
+	if options.Limit < 0 || options.Offset < 0 {
+		return errors.New("limit and offset may not be negative")
+	}
+	if len(options.Type) > 0 && options.Type != RuleTypeCustom && options.Type != RuleTypeTemplate {
+		return errors.New("unknown type " + options.Type)
+	}
+	if len(options.Target) > 0 {
+		if _, err := TableRegExForTarget(options.Target); err != nil {
+			return err
+		}
+	}
+	if len(options.Sort) > 0 && !slices.Contains(RuleSortFields, options.Sort) {
+		return errors.New("unknown sort field " + options.Sort)
+	}
+	if len(options.Order) > 0 && options.Order != "asc" && options.Order != "desc" {
+		return errors.New("order must be asc or desc")
+	}
+	return nil
 }
 
 type TableInfo struct {
-	Table          string
-	UserIds        []string
-	Roles          []string
-	ShortUserId    string
-	DeviceId       string
-	ShortDeviceId  string
-	ServiceId      string
-	ShortServiceId string
-	ExportId       string
-	ShortExportId  string
-	Columns        []string
-	Timezone       string
+	Table          string         `json:"table"`
+	UserIds        []string       `json:"user_ids"`
+	Roles          []string       `json:"roles"`
+	ShortUserId    string         `json:"short_user_id,omitempty"`
+	DeviceId       string         `json:"device_id,omitempty"`
+	ShortDeviceId  string         `json:"short_device_id,omitempty"`
+	ServiceId      string         `json:"service_id,omitempty"`
+	ShortServiceId string         `json:"short_service_id,omitempty"`
+	ExportId       string         `json:"export_id,omitempty"`
+	ShortExportId  string         `json:"short_export_id,omitempty"`
+	Columns        []string       `json:"columns"`
+	Timezone       string         `json:"timezone"`
+	Params         map[string]any `json:"params,omitempty"` // Parameter values of the rule being rendered
+}
+
+type RuleStatus = string
+
+const RuleStatusApplied RuleStatus = "applied"   // the rule is applied to the table
+const RuleStatusShadowed RuleStatus = "shadowed" // a rule of the same group with higher priority is applied instead
+const RuleStatusExcluded RuleStatus = "excluded" // the rule does not apply to any owner of the table
+
+// RuleTable describes how a rule relates to a table matching its TableRegEx.
+type RuleTable struct {
+	Table      string     `json:"table"`
+	OwnerMatch bool       `json:"owner_match"` // users or roles of the rule overlap with the owners of the table
+	WinsGroup  bool       `json:"wins_group"`  // the rule has the highest priority of its group on the table
+	Status     RuleStatus `json:"status,omitempty"`
+	ShadowedBy string     `json:"shadowed_by,omitempty"`
+	Error      string     `json:"error,omitempty"` // set if the owners of the table could not be resolved
+}
+
+// TableRule is a rule matching a table by TableRegEx with its status on that table.
+type TableRule struct {
+	TypedRule
+	Status     RuleStatus `json:"status"`
+	ShadowedBy string     `json:"shadowed_by,omitempty"`
+}
+
+type TableRules struct {
+	TableInfo TableInfo   `json:"table_info"`
+	Rules     []TableRule `json:"rules"`
+}
+
+type RulePreview struct {
+	TableInfo    TableInfo `json:"table_info"`
+	Command      string    `json:"command"`
+	CommandError string    `json:"command_error,omitempty"`
+	Delete       string    `json:"delete"`
+	DeleteError  string    `json:"delete_error,omitempty"`
+}
+
+type DryRunRequest struct {
+	Tables []string `json:"tables,omitempty"` // defaults to all tables matching the rule
+	Delete bool     `json:"delete"`           // also execute the delete template after the command template
+}
+
+type DryRunResult struct {
+	Table        string `json:"table"`
+	Applied      bool   `json:"applied"` // false if the rule does not apply to the table, e.g. because of owners or priority
+	Success      bool   `json:"success"`
+	CommandError string `json:"command_error,omitempty"`
+	DeleteError  string `json:"delete_error,omitempty"`
+	Error        string `json:"error,omitempty"`
 }
@@ -18,33 +18,115 @@ package model
 
 import (
 	"errors"
+	"reflect"
+	"slices"
+
 	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
 )
 
+// Type describes the rule as template rule if it was created from a template and as custom rule otherwise.
+// The target of template rules is resolved from the registered targets by the TableRegEx of the rule.
+// The stored target is kept if no registered target uses the TableRegEx.
 func (rule *Rule) Type() (*TypedRule, error) {
+	if len(rule.TemplateName) > 0 {
+		target := rule.TemplateTarget
+		ts, err := templates.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := ts.TargetForTableRegEx(rule.TableRegEx); ok {
+			target = t.Name
+		}
+		return &TypedRule{
+			Rule:     rule,
+			Type:     RuleTypeTemplate,
+			Template: rule.TemplateName,
+			Target:   target,
+		}, nil
+	}
+	return &TypedRule{
+		Rule: rule,
+		Type: RuleTypeCustom,
+	}, nil
+}
+
+// InferTemplate sets TemplateName and TemplateTarget if the rule matches a template by its fields.
+// Only needed for rules saved before the template was stored with the rule.
+func (rule *Rule) InferTemplate() (found bool, err error) {
 	ts, err := templates.New(nil)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	for template, tmpl := range ts.Templates {
+	for template, tmpl := range ts.List() {
 		if rule.matchesTemplate(tmpl) {
-			tr := &TypedRule{
-				Rule:     rule,
-				Type:     RuleTypeTemplate,
-				Template: template,
+			rule.TemplateName = template
+			rule.TemplateVersion = tmpl.Version
+			rule.TemplateTarget = ""
+			if target, ok := ts.TargetForTableRegEx(rule.TableRegEx); ok {
+				rule.TemplateTarget = target.Name
 			}
-			if rule.TableRegEx == "^device:.{22}_service:.{22}$" {
-				tr.Target = TemplateRuleTargetDevice
-			} else if rule.TableRegEx == "^userid:.{22}_export:.{22}$" {
-				tr.Target = TemplateRuleTargetExport
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TableRegExForTarget returns the TableRegEx used by template rules with the given target.
+func TableRegExForTarget(target TemplateRuleTarget) (string, error) {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return "", err
+	}
+	t, ok := ts.Target(target)
+	if !ok {
+		return "", errors.New("unknown TemplateRule target")
+	}
+	return t.TableRegEx, nil
+}
+
+// CheckEditable returns an error if r changes fields of current that non-admins may not change
+// for the target of current or the target of r.
+func (r *TemplateRule) CheckEditable(current TemplateRule) error {
+	ts, err := templates.New(nil)
+	if err != nil {
+		return err
+	}
+	changed := map[string]bool{
+		"users":      !slices.Equal(r.Users, current.Users),
+		"roles":      !slices.Equal(r.Roles, current.Roles),
+		"template":   r.Template != current.Template,
+		"parameters": r.parametersChanged(ts, current),
+		"target":     r.Target != current.Target,
+	}
+	for _, name := range []TemplateRuleTarget{current.Target, r.Target} {
+		target, ok := ts.Target(name)
+		if !ok {
+			continue
+		}
+		for _, field := range templates.EditableFields {
+			if changed[field] && !templates.IsEditable(target, field) {
+				return errors.New("field " + field + " is not editable for target " + target.Name)
 			}
-			return tr, nil
 		}
 	}
-	return &TypedRule{
-		Rule: rule,
-		Type: RuleTypeCustom,
-	}, nil
+	return nil
+}
+
+// parametersChanged compares the parameters resolved by the template, as stored parameters are decoded with other
+// number types than requested parameters and include defaults. Parameters that can not be resolved are compared
+// as they are.
+func (r *TemplateRule) parametersChanged(ts *templates.TemplateStore, current TemplateRule) bool {
+	tmpl, ok := ts.Get(current.Template)
+	if ok && r.Template == current.Template {
+		requested, err := tmpl.ResolveParameters(r.Parameters)
+		if err == nil {
+			stored, err := tmpl.ResolveParameters(current.Parameters)
+			if err == nil {
+				return !reflect.DeepEqual(requested, stored)
+			}
+		}
+	}
+	return !reflect.DeepEqual(r.Parameters, current.Parameters)
 }
 
 func (rule *Rule) matchesTemplate(template templates.Template) bool {
@@ -57,7 +139,7 @@ func (r *TemplateRule) Rule() (*Rule, error) {
 		return nil, err
 	}
 
-	tmpl, ok := ts.Templates[r.Template]
+	tmpl, ok := ts.Get(r.Template)
 	if !ok {
 		return nil, errors.New("unknown TemplateRule template")
 	}
@@ -70,15 +152,39 @@ func (r *TemplateRule) Rule() (*Rule, error) {
 		Roles:           r.Roles,
 		CommandTemplate: tmpl.CommandTemplate,
 		DeleteTemplate:  tmpl.DeleteTemplate,
+		Version:         r.Version,
+		TemplateName:    r.Template,
+		TemplateTarget:  r.Target,
+		TemplateVersion: tmpl.Version,
+		DependsOn:       tmpl.DependsOn,
 	}
-	switch r.Target {
-	case TemplateRuleTargetDevice:
-		rule.TableRegEx = "^device:.{22}_service:.{22}$"
-	case TemplateRuleTargetExport:
-		rule.TableRegEx = "^userid:.{22}_export:.{22}$"
-	default:
-		return nil, errors.New("unknown TemplateRule target")
+	rule.TableRegEx, err = TableRegExForTarget(r.Target)
+	if err != nil {
+		return nil, err
+	}
+	rule.Parameters, err = tmpl.ResolveParameters(r.Parameters)
+	if err != nil {
+		return nil, err
 	}
 
 	return &rule, nil
 }
+
+// TemplateRule returns the rule in the shape it was created from a template.
+func (rule *Rule) TemplateRule() (*TemplateRule, error) {
+	if len(rule.TemplateName) == 0 {
+		return nil, errors.New("not a template rule")
+	}
+	return &TemplateRule{
+		Id:              rule.Id,
+		Target:          rule.TemplateTarget,
+		Users:           rule.Users,
+		Roles:           rule.Roles,
+		Template:        rule.TemplateName,
+		Parameters:      rule.Parameters,
+		TemplateVersion: rule.TemplateVersion,
+		Version:         rule.Version,
+		Errors:          rule.Errors,
+		CompletedRun:    rule.CompletedRun,
+	}, nil
+}
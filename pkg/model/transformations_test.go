@@ -0,0 +1,132 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/templates"
+)
+
+func setupTemplates(t *testing.T) *templates.TemplateStore {
+	log.InitForTest()
+	ts, err := templates.New(&config.Config{TemplateRuleTargets: []config.TemplateRuleTarget{
+		{Name: "restricted", TableRegEx: "^restricted:.*$", EditableFields: []string{"parameters"}},
+		{Name: templates.TargetExport, TableRegEx: "^export:.*$", EditableFields: []string{"users"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	min := float64(1)
+	_, err = ts.Set(templates.Template{
+		Name:            "retention",
+		CommandTemplate: "SELECT {{.Params.days}}, {{.Params.compress}};",
+		DeleteTemplate:  "SELECT 1;",
+		Parameters: []templates.Parameter{
+			{Name: "days", Type: templates.ParameterTypeInteger, Min: &min},
+			{Name: "compress", Type: templates.ParameterTypeBoolean, Default: false},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestTargets(t *testing.T) {
+	setupTemplates(t)
+	for target, expected := range map[TemplateRuleTarget]string{
+		TemplateRuleTargetDevice: "^device:.{22}_service:.{22}$",
+		TemplateRuleTargetExport: "^export:.*$",
+		"restricted":             "^restricted:.*$",
+	} {
+		regex, err := TableRegExForTarget(target)
+		if err != nil {
+			t.Error(target, err)
+		}
+		if regex != expected {
+			t.Error(target, "unexpected table_reg_ex", regex)
+		}
+	}
+	_, err := TableRegExForTarget("unknown")
+	if err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
+
+func TestType(t *testing.T) {
+	setupTemplates(t)
+	for name, test := range map[string]struct {
+		rule   Rule
+		typ    RuleType
+		target TemplateRuleTarget
+	}{
+		"custom":          {rule: Rule{TableRegEx: "^export:.*$"}, typ: RuleTypeCustom},
+		"resolved target": {rule: Rule{TemplateName: "retention", TemplateTarget: "old", TableRegEx: "^restricted:.*$"}, typ: RuleTypeTemplate, target: "restricted"},
+		"stored target":   {rule: Rule{TemplateName: "retention", TemplateTarget: "old", TableRegEx: "^other$"}, typ: RuleTypeTemplate, target: "old"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			typed, err := test.rule.Type()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typed.Type != test.typ || typed.Target != test.target {
+				t.Error("unexpected type", typed.Type, typed.Target)
+			}
+		})
+	}
+}
+
+func TestCheckEditable(t *testing.T) {
+	setupTemplates(t)
+	// stored parameters are decoded as json.Number or int64 and include defaults
+	stored := TemplateRule{Template: "retention", Target: "restricted", Users: []string{"a"},
+		Parameters: map[string]any{"days": json.Number("7"), "compress": false}}
+	for name, test := range map[string]struct {
+		current  TemplateRule
+		rule     TemplateRule
+		editable bool
+	}{
+		"unchanged": {current: stored, rule: TemplateRule{Template: "retention", Target: "restricted", Users: []string{"a"},
+			Parameters: map[string]any{"days": float64(7)}}, editable: true},
+		"stored int64": {current: TemplateRule{Template: "retention", Target: TemplateRuleTargetExport, Users: []string{"a"},
+			Parameters: map[string]any{"days": int64(7), "compress": false}}, rule: TemplateRule{Template: "retention", Target: TemplateRuleTargetExport, Users: []string{"b"},
+			Parameters: map[string]any{"days": float64(7)}}, editable: true},
+		"editable parameters": {current: stored, rule: TemplateRule{Template: "retention", Target: "restricted", Users: []string{"a"},
+			Parameters: map[string]any{"days": float64(8)}}, editable: true},
+		"restricted users": {current: stored, rule: TemplateRule{Template: "retention", Target: "restricted", Users: []string{"b"},
+			Parameters: map[string]any{"days": float64(7)}}, editable: false},
+		"restricted parameters": {current: TemplateRule{Template: "retention", Target: TemplateRuleTargetExport, Users: []string{"a"},
+			Parameters: map[string]any{"days": int64(7), "compress": false}}, rule: TemplateRule{Template: "retention", Target: TemplateRuleTargetExport, Users: []string{"a"},
+			Parameters: map[string]any{"days": float64(7), "compress": true}}, editable: false},
+		"restricted target": {current: stored, rule: TemplateRule{Template: "retention", Target: TemplateRuleTargetExport, Users: []string{"a"},
+			Parameters: map[string]any{"days": float64(7)}}, editable: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := test.rule.CheckEditable(test.current)
+			if test.editable && err != nil {
+				t.Error(err)
+			}
+			if !test.editable && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
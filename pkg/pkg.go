@@ -34,7 +34,7 @@ import (
 func Start(fatal func(error), ctx context.Context, conf config.Config) (wg *sync.WaitGroup, err error) {
 	wg = &sync.WaitGroup{}
 
-	_, err = templates.New(&conf)
+	ts, err := templates.New(&conf)
 	if err != nil {
 		log.Logger.Warn("Could not read templates", attributes.ErrorKey, err)
 	}
@@ -42,6 +42,10 @@ func Start(fatal func(error), ctx context.Context, conf config.Config) (wg *sync
 	if err != nil {
 		return wg, err
 	}
+	err = ts.UsePersistence(db, ctx, wg)
+	if err != nil {
+		return wg, err
+	}
 
 	permV2 := client.New(conf.PermissionsV2Url)
 
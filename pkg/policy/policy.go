@@ -0,0 +1,345 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package policy
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	pgquery "github.com/wasilibs/go-pgquery"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DefaultAllowedStatements are the statement kinds allowed if none are configured.
+// Kinds are the names of the statement nodes of the Postgres parse tree, e.g. create_stmt for CREATE TABLE.
+var DefaultAllowedStatements = []string{
+	"create_stmt",          // CREATE TABLE
+	"view_stmt",            // CREATE VIEW
+	"create_table_as_stmt", // CREATE MATERIALIZED VIEW, including continuous aggregates
+	"index_stmt",           // CREATE INDEX
+	"alter_table_stmt",
+	"drop_stmt",
+	"select_stmt", // e.g. add_continuous_aggregate_policy(...)
+	"call_stmt",   // e.g. refresh_continuous_aggregate(...)
+	"refresh_mat_view_stmt",
+	"comment_stmt",
+	"grant_stmt",
+}
+
+// DefaultAllowedFunctions are the functions SELECT and CALL statements may call if none are configured.
+// Functions called in other statements, e.g. in the query of a view, are not restricted.
+var DefaultAllowedFunctions = []string{
+	"create_hypertable",
+	"set_chunk_time_interval",
+	"add_continuous_aggregate_policy",
+	"remove_continuous_aggregate_policy",
+	"refresh_continuous_aggregate",
+	"add_retention_policy",
+	"remove_retention_policy",
+	"add_compression_policy",
+	"remove_compression_policy",
+	"add_columnstore_policy",
+	"remove_columnstore_policy",
+	"add_reorder_policy",
+	"remove_reorder_policy",
+	"show_chunks",
+	"drop_chunks",
+	"compress_chunk",
+	"decompress_chunk",
+}
+
+// destructiveFunctions remove data of the relation given as first argument.
+var destructiveFunctions = []string{"drop_chunks", "add_retention_policy"}
+
+// defaultSchema is the schema of unqualified relation names. Tables rules apply to are in this schema.
+const defaultSchema = "public"
+
+// Policy checks rendered rule SQL before it is executed.
+type Policy struct {
+	allowedStatements []string
+	allowedDropTypes  []string
+	allowedFunctions  []string
+}
+
+// New creates a Policy allowing the given statement kinds, or DefaultAllowedStatements if none are given.
+// Dropping objects other than relations is only allowed for the given object types, e.g. function or trigger.
+// SELECT and CALL statements may only call the given functions, or DefaultAllowedFunctions if none are given.
+func New(allowedStatements []string, allowedDropTypes []string, allowedFunctions []string) *Policy {
+	if len(allowedStatements) == 0 {
+		allowedStatements = DefaultAllowedStatements
+	}
+	if len(allowedFunctions) == 0 {
+		allowedFunctions = DefaultAllowedFunctions
+	}
+	return &Policy{allowedStatements: allowedStatements, allowedDropTypes: allowedDropTypes, allowedFunctions: allowedFunctions}
+}
+
+// Created returns the schema qualified names of the relations created by the statements of query,
+// e.g. public.name. Returns nil if query can not be parsed.
+func Created(query string) []string {
+	tree, err := pgquery.Parse(query)
+	if err != nil {
+		return nil
+	}
+	created := []string{}
+	for _, raw := range tree.GetStmts() {
+		_, stmt := unwrap(raw.GetStmt().ProtoReflect())
+		switch stmt.Descriptor().Name() {
+		case "CreateStmt":
+			created = append(created, relationName(message(stmt, "relation")))
+		case "ViewStmt":
+			created = append(created, relationName(message(stmt, "view")))
+		case "CreateTableAsStmt":
+			created = append(created, relationName(message(message(stmt, "into"), "rel")))
+		case "IndexStmt":
+			// indexes are created in the schema of their table
+			schema := get(message(stmt, "relation"), "schemaname").String()
+			created = append(created, qualifiedName(schema, get(stmt, "idxname").String()))
+		}
+	}
+	return created
+}
+
+// Check parses query and returns an error if it contains a statement kind that is not allowed, or if it drops,
+// truncates, alters, deletes from or updates the source table or a relation that is not in created. Statements
+// nested in other statements, e.g. in WITH clauses, are checked as well, except for queries like the query of a
+// view. Functions called by SELECT and CALL statements have to be allowed. Relations created by query itself count as created. Names in created have to be schema qualified,
+// see Created. The source table is in the public schema.
+func (this *Policy) Check(query string, source string, created []string) error {
+	tree, err := pgquery.Parse(query)
+	if err != nil {
+		return errors.New("policy: could not parse sql: " + err.Error())
+	}
+	source = qualifiedName("", source)
+	created = append(slices.Clone(created), Created(query)...)
+	checkTarget := func(action string, relation string) error {
+		if relation == source {
+			return errors.New("policy: " + action + " of source table " + source + " is not allowed")
+		}
+		if !slices.Contains(created, relation) {
+			return errors.New("policy: " + action + " of " + relation + " is not allowed, it was not created by the rule")
+		}
+		return nil
+	}
+	for _, raw := range tree.GetStmts() {
+		root := raw.GetStmt().ProtoReflect()
+		rootKind, _ := unwrap(root)
+		checkFunctions := rootKind == "select_stmt" || rootKind == "call_stmt"
+		err = walk(root, func(m protoreflect.Message) error {
+			switch m.Descriptor().Name() {
+			case "Node":
+				kind, _ := unwrap(m)
+				if !strings.HasSuffix(kind, "_stmt") || (kind == "select_stmt" && m != root) {
+					return nil
+				}
+				if !slices.Contains(this.allowedStatements, kind) {
+					return errors.New("policy: statement " + kind + " is not allowed")
+				}
+			case "DropStmt":
+				objectType := objectTypeName(m, "remove_type")
+				if !isRelationType(objectType) {
+					if !slices.Contains(this.allowedDropTypes, objectType) {
+						return errors.New("policy: DROP " + strings.ToUpper(objectType) + " is not allowed")
+					}
+					return nil
+				}
+				for _, object := range list(m, "objects") {
+					err := checkTarget("DROP", objectName(object))
+					if err != nil {
+						return err
+					}
+				}
+			case "TruncateStmt":
+				for _, relation := range list(m, "relations") {
+					_, rangeVar := unwrap(relation)
+					err := checkTarget("TRUNCATE", relationName(rangeVar))
+					if err != nil {
+						return err
+					}
+				}
+			case "DeleteStmt":
+				return checkTarget("DELETE", relationName(message(m, "relation")))
+			case "UpdateStmt":
+				return checkTarget("UPDATE", relationName(message(m, "relation")))
+			case "AlterTableStmt":
+				return checkTarget("ALTER", relationName(message(m, "relation")))
+			case "FuncCall":
+				name := ""
+				if names := list(m, "funcname"); len(names) > 0 {
+					_, last := unwrap(names[len(names)-1])
+					name = get(last, "sval").String()
+				}
+				if checkFunctions && !slices.Contains(this.allowedFunctions, name) {
+					return errors.New("policy: function " + name + " is not allowed")
+				}
+				if !slices.Contains(destructiveFunctions, name) {
+					return nil
+				}
+				args := list(m, "args")
+				relation := ""
+				if len(args) > 0 {
+					relation = regclassName(args[0])
+				}
+				if len(relation) == 0 {
+					return errors.New("policy: " + name + " is only allowed with a relation name as first argument")
+				}
+				return checkTarget(name, relation)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls f for m and every message nested in m, depth first. Stops at the first error returned by f.
+func walk(m protoreflect.Message, f func(m protoreflect.Message) error) (err error) {
+	err = f(m)
+	if err != nil {
+		return err
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			for i := range v.List().Len() {
+				err = walk(v.List().Get(i).Message(), f)
+				if err != nil {
+					return false
+				}
+			}
+			return true
+		}
+		err = walk(v.Message(), f)
+		return err == nil
+	})
+	return err
+}
+
+// unwrap returns the kind and the message of a Node, e.g. create_stmt and the CreateStmt.
+func unwrap(node protoreflect.Message) (kind string, inner protoreflect.Message) {
+	field := node.WhichOneof(node.Descriptor().Oneofs().ByName("node"))
+	if field == nil {
+		return "unknown", node
+	}
+	return string(field.Name()), node.Get(field).Message()
+}
+
+func field(m protoreflect.Message, name string) protoreflect.FieldDescriptor {
+	return m.Descriptor().Fields().ByName(protoreflect.Name(name))
+}
+
+func get(m protoreflect.Message, name string) protoreflect.Value {
+	return m.Get(field(m, name))
+}
+
+func message(m protoreflect.Message, name string) protoreflect.Message {
+	return get(m, name).Message()
+}
+
+func list(m protoreflect.Message, name string) []protoreflect.Message {
+	l := get(m, name).List()
+	result := make([]protoreflect.Message, 0, l.Len())
+	for i := range l.Len() {
+		result = append(result, l.Get(i).Message())
+	}
+	return result
+}
+
+// objectTypeName returns the object type of an ObjectType field in lower case without prefix, e.g. table.
+func objectTypeName(m protoreflect.Message, name string) string {
+	fd := field(m, name)
+	value := fd.Enum().Values().ByNumber(m.Get(fd).Enum())
+	if value == nil {
+		return "unknown"
+	}
+	return strings.ToLower(strings.TrimPrefix(string(value.Name()), "OBJECT_"))
+}
+
+func isRelationType(objectType string) bool {
+	switch objectType {
+	case "table", "view", "matview", "index", "foreign_table", "sequence":
+		return true
+	default:
+		return false
+	}
+}
+
+func qualifiedName(schema string, name string) string {
+	if len(schema) == 0 {
+		schema = defaultSchema
+	}
+	return schema + "." + name
+}
+
+// relationName returns the schema qualified name of a RangeVar.
+func relationName(rangeVar protoreflect.Message) string {
+	return qualifiedName(get(rangeVar, "schemaname").String(), get(rangeVar, "relname").String())
+}
+
+// objectName returns the schema qualified name of a dropped object, which is a list of name parts like schema and name.
+func objectName(object protoreflect.Message) string {
+	_, names := unwrap(object)
+	parts := []string{}
+	for _, item := range list(names, "items") {
+		_, s := unwrap(item)
+		parts = append(parts, get(s, "sval").String())
+	}
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return qualifiedName("", parts[0])
+	default:
+		return qualifiedName(parts[len(parts)-2], parts[len(parts)-1])
+	}
+}
+
+// regclassName returns the schema qualified name of a relation given as string constant, e.g. '"device:abc"'.
+// Returns an empty string if the argument is not a string constant or not a relation name.
+func regclassName(arg protoreflect.Message) string {
+	kind, value := unwrap(arg)
+	if kind == "type_cast" {
+		kind, value = unwrap(message(value, "arg"))
+	}
+	if kind != "a_const" {
+		return ""
+	}
+	sval := message(value, "sval")
+	if !sval.IsValid() {
+		return ""
+	}
+	// the constant is parsed like a relation name in a query
+	tree, err := pgquery.Parse("TABLE " + get(sval, "sval").String())
+	if err != nil || len(tree.GetStmts()) != 1 {
+		return ""
+	}
+	_, stmt := unwrap(tree.GetStmts()[0].GetStmt().ProtoReflect())
+	from := list(stmt, "from_clause")
+	if len(from) != 1 {
+		return ""
+	}
+	kind, rangeVar := unwrap(from[0])
+	if kind != "range_var" {
+		return ""
+	}
+	return relationName(rangeVar)
+}
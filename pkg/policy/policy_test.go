@@ -0,0 +1,100 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package policy
+
+import (
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	p := New(nil, nil, nil)
+	source := "device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw"
+	command := `CREATE MATERIALIZED VIEW "` + source + `_ld" WITH (timescaledb.continuous) AS SELECT time_bucket('1 day', time) AS time, last(value, time) FROM "` + source + `" GROUP BY 1;
+SELECT add_continuous_aggregate_policy('"` + source + `_ld"', start_offset => NULL, end_offset => INTERVAL '1 hour', schedule_interval => INTERVAL '1 hour');`
+	created := Created(command)
+	if len(created) != 1 || created[0] != "public."+source+"_ld" {
+		t.Fatal("unexpected created relations", created)
+	}
+	for name, tc := range map[string]struct {
+		query string
+		ok    bool
+	}{
+		"command":                {command, true},
+		"drop created":           {`DROP MATERIALIZED VIEW IF EXISTS "` + source + `_ld";`, true},
+		"drop and create in one": {`DROP VIEW IF EXISTS "x"; CREATE VIEW "x" AS SELECT 1;`, true},
+		"drop source":            {`DROP MATERIALIZED VIEW "` + source + `";`, false},
+		"drop source table":      {`DROP TABLE "` + source + `" CASCADE;`, false},
+		"drop other":             {`DROP VIEW "other";`, false},
+		"truncate source":        {`TRUNCATE "` + source + `";`, false},
+		"delete from source":     {`DELETE FROM "` + source + `" WHERE true;`, false},
+		"delete from created":    {`DELETE FROM "` + source + `_ld";`, false}, // delete_stmt is not allowed by default
+		"statement not allowed":  {`CREATE ROLE hacker SUPERUSER;`, false},
+		"syntax error":           {`DROP MATERIALIZED VIEW "`, false},
+		"drop function":          {`DROP FUNCTION IF EXISTS f();`, false},
+		"drop schema":            {`DROP SCHEMA public CASCADE;`, false},
+		"drop extension":         {`DROP EXTENSION timescaledb CASCADE;`, false},
+		"drop other schema":      {`DROP TABLE other."` + source + `_ld";`, false},
+		"drop qualified created": {`DROP MATERIALIZED VIEW public."` + source + `_ld";`, true},
+		"alter source":           {`ALTER TABLE "` + source + `" DROP COLUMN value;`, false},
+		"alter created":          {`ALTER MATERIALIZED VIEW "` + source + `_ld" SET (timescaledb.materialized_only = false);`, true},
+		"delete in cte":          {`WITH d AS (DELETE FROM "` + source + `" RETURNING 1) SELECT * FROM d;`, false},
+		"drop_chunks source":     {`SELECT drop_chunks('"` + source + `"', older_than => INTERVAL '1 day');`, false},
+		"drop_chunks nested":     {`SELECT 1 FROM (SELECT drop_chunks('"` + source + `"'::regclass, INTERVAL '1 day')) c;`, false},
+		"drop_chunks created":    {`SELECT drop_chunks('"` + source + `_ld"', older_than => INTERVAL '1 day');`, true},
+		"drop_chunks dynamic":    {`SELECT drop_chunks(format('%I', 'x'), INTERVAL '1 day');`, false},
+		"retention on created":   {`SELECT add_retention_policy('public."` + source + `_ld"', INTERVAL '1 year');`, true},
+		"function not allowed":   {`SELECT pg_terminate_backend(1);`, false},
+		"qualified function":     {`SELECT pg_catalog.pg_read_file('/etc/passwd');`, false},
+		"function in subquery":   {`SELECT * FROM (SELECT lo_import('/etc/passwd')) f;`, false},
+		"call allowed":           {`CALL refresh_continuous_aggregate('"` + source + `_ld"', NULL, NULL);`, true},
+		"call not allowed":       {`CALL other_procedure();`, false},
+		"function in view":       {`CREATE VIEW "` + source + `_v" AS SELECT count(*) FROM "` + source + `";`, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := p.Check(tc.query, source, created)
+			if tc.ok && err != nil {
+				t.Error(err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("expected policy violation")
+			}
+		})
+	}
+	t.Run("custom allow list", func(t *testing.T) {
+		err := New([]string{"delete_stmt"}, nil, nil).Check(`DELETE FROM "`+source+`_ld";`, source, created)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("custom functions", func(t *testing.T) {
+		err := New(nil, nil, []string{"count"}).Check(`SELECT count(*) FROM "`+source+`_ld";`, source, created)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("custom drop types", func(t *testing.T) {
+		p := New(nil, []string{"function"}, nil)
+		err := p.Check(`DROP FUNCTION IF EXISTS f();`, source, created)
+		if err != nil {
+			t.Error(err)
+		}
+		err = p.Check(`DROP SCHEMA public CASCADE;`, source, created)
+		if err == nil {
+			t.Error("expected policy violation")
+		}
+	})
+}
@@ -0,0 +1,334 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/SENERGY-Platform/go-service-base/struct-logger/attributes"
+	log "github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/fsnotify/fsnotify"
+	"sigs.k8s.io/yaml"
+)
+
+// PartialsDir is the directory of the TemplateDir holding partials. Partials are template fragments
+// usable in all templates with {{template "name" .}}, where name is the path of the file in the
+// PartialsDir without extension.
+const PartialsDir = "partials"
+
+var templateExtensions = []string{".json", ".yaml", ".yml"}
+
+// templateName returns the name of the template in the file at path: the path relative to dir without extension.
+// Templates in subdirectories are namespaced by the subdirectory, e.g. aggregates/hourly.
+func templateName(dir string, path string) (name string, ok bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(rel, PartialsDir+"/") {
+		return "", false
+	}
+	ext := filepath.Ext(rel)
+	if !slices.Contains(templateExtensions, ext) {
+		return "", false
+	}
+	return strings.TrimSuffix(rel, ext), true
+}
+
+// partialName returns the name of the partial in the file at path, if the file is in the PartialsDir.
+func partialName(dir string, path string) (name string, ok bool) {
+	rel, err := filepath.Rel(filepath.Join(dir, PartialsDir), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	return strings.TrimSuffix(rel, filepath.Ext(rel)), true
+}
+
+// loadDir reads all partials and templates below sub, which is dir or one of its subdirectories. Partials are read
+// first, so templates can use them. Files that can not be read are reported in loadErrors. All directories are
+// returned to be watched.
+func (this *TemplateStore) loadDir(dir string, sub string) (dirs []string, loadErrors []error, err error) {
+	partialFiles := []string{}
+	templateFiles := []string{}
+	err = filepath.WalkDir(sub, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if _, ok := partialName(dir, path); ok {
+			partialFiles = append(partialFiles, path)
+		} else if _, ok := templateName(dir, path); ok {
+			templateFiles = append(templateFiles, path)
+		} else {
+			log.Logger.Info("Ignoring template: does not end in .json, .yaml or .yml", "file", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, path := range partialFiles {
+		err = this.loadPartial(dir, path)
+		if err != nil {
+			loadErrors = append(loadErrors, err)
+		}
+	}
+	if len(partialFiles) > 0 {
+		this.revalidate(dir)
+	}
+	for _, path := range templateFiles {
+		tmpl, err := readTemplateFile(dir, path)
+		if err != nil {
+			log.Logger.Warn("Ignoring invalid template", "file", path, attributes.ErrorKey, err)
+			this.setInvalid(tmpl, relPath(dir, path), err)
+			loadErrors = append(loadErrors, errors.New(relPath(dir, path)+": "+err.Error()))
+			continue
+		}
+		err = this.setFromFile(tmpl)
+		if err != nil {
+			loadErrors = append(loadErrors, errors.New(relPath(dir, path)+": "+err.Error()))
+		}
+	}
+	return dirs, loadErrors, nil
+}
+
+// setFromFile stores the template read from a file. Once the store uses a persistence, the TemplateDir is only a
+// seed: the template is inserted if it is missing, but stored templates are never overwritten, as they might have
+// been changed through the API.
+func (this *TemplateStore) setFromFile(tmpl Template) error {
+	persistence := this.getPersistence()
+	if persistence == nil {
+		_, err := this.Set(tmpl)
+		return err
+	}
+	this.clearInvalid(tmpl.Name)
+	tmpl.Version = max(tmpl.Version, 1)
+	err := persistence.InsertTemplateIfMissing(tmpl)
+	if err != nil {
+		return err
+	}
+	return this.reloadTemplate(tmpl.Name)
+}
+
+// loadPartial reads the partial in the file at path. Like templates, partials are only inserted if they are missing
+// once the store uses a persistence, see setFromFile.
+func (this *TemplateStore) loadPartial(dir string, path string) error {
+	name, _ := partialName(dir, path)
+	b, err := os.ReadFile(path)
+	if err == nil {
+		_, err = template.New(name).Funcs(FuncMap).Parse(string(b))
+	}
+	if err != nil {
+		log.Logger.Warn("Ignoring invalid partial", "file", path, attributes.ErrorKey, err)
+		this.setInvalid(Template{Name: PartialsDir + "/" + name}, relPath(dir, path), err)
+		return errors.New(relPath(dir, path) + ": " + err.Error())
+	}
+	this.clearInvalid(PartialsDir + "/" + name)
+	persistence := this.getPersistence()
+	if persistence != nil {
+		err = persistence.InsertPartialIfMissing(Partial{Name: name, Template: string(b)})
+		if err == nil {
+			err = this.reload()
+		}
+		if err != nil {
+			log.Logger.Error("could not store partial", "file", path, attributes.ErrorKey, err)
+			return errors.New(relPath(dir, path) + ": " + err.Error())
+		}
+		return nil
+	}
+	this.mux.Lock()
+	this.partials[name] = string(b)
+	this.mux.Unlock()
+	return nil
+}
+
+// revalidate validates all templates again after partials changed, if the store does not use a persistence.
+// Templates that became invalid are skipped and reported by Status. Invalid templates are stored if they became
+// valid, template files are read again.
+func (this *TemplateStore) revalidate(dir string) {
+	if this.getPersistence() != nil {
+		// reloaded and validated with the persisted partials
+		return
+	}
+	for name, tmpl := range this.List() {
+		err := tmpl.Validate()
+		if err != nil {
+			log.Logger.Warn("Ignoring template invalidated by changed partials", "template", name, attributes.ErrorKey, err)
+			this.mux.Lock()
+			delete(this.templates, name)
+			this.invalid[name] = TemplateInfo{Template: tmpl, Status: TemplateStatusInvalid, Error: err.Error()}
+			this.mux.Unlock()
+		}
+	}
+	this.mux.RLock()
+	invalid := make([]TemplateInfo, 0, len(this.invalid))
+	for name, info := range this.invalid {
+		if !strings.HasPrefix(name, PartialsDir+"/") {
+			invalid = append(invalid, info)
+		}
+	}
+	this.mux.RUnlock()
+	for _, info := range invalid {
+		if len(info.File) > 0 {
+			tmpl, err := readTemplateFile(dir, filepath.Join(dir, filepath.FromSlash(info.File)))
+			if err != nil {
+				this.setInvalid(tmpl, info.File, err)
+				continue
+			}
+			_, err = this.Set(tmpl)
+			if err != nil {
+				log.Logger.Error("could not store template", "template", tmpl.Name, attributes.ErrorKey, err)
+			}
+			continue
+		}
+		err := info.Template.Validate()
+		if err != nil {
+			this.setInvalid(info.Template, "", err)
+			continue
+		}
+		this.clearInvalid(info.Name)
+		this.put(info.Template)
+	}
+}
+
+func (this *TemplateStore) handleFileEvent(dir string, watcher *fsnotify.Watcher, event fsnotify.Event) {
+	switch event.Op {
+	// A new pathname was created.
+	case fsnotify.Create, fsnotify.Write:
+		info, err := os.Stat(event.Name)
+		if err != nil {
+			log.Logger.Error("ERROR in fsnotify watcher. Templates might not update automatically", attributes.ErrorKey, err)
+			return
+		}
+		if info.IsDir() {
+			dirs, _, err := this.loadDir(dir, event.Name)
+			if err != nil {
+				log.Logger.Error("ERROR in fsnotify watcher. Templates might not update automatically", attributes.ErrorKey, err)
+			}
+			for _, d := range dirs {
+				err = watcher.Add(d)
+				if err != nil {
+					log.Logger.Error("ERROR in fsnotify watcher. Templates might not update automatically", attributes.ErrorKey, err)
+				}
+			}
+			return
+		}
+		if _, ok := partialName(dir, event.Name); ok {
+			err = this.loadPartial(dir, event.Name)
+			if err == nil {
+				this.revalidate(dir)
+			}
+			return
+		}
+		if _, ok := templateName(dir, event.Name); !ok {
+			log.Logger.Debug("Ignoring template: does not end in .json, .yaml or .yml", "file", event.Name)
+			return
+		}
+		ruleTmpl, err := readTemplateFile(dir, event.Name)
+		if err != nil {
+			log.Logger.Error("ERROR in fsnotify watcher. Ignoring invalid template", "file", event.Name, attributes.ErrorKey, err)
+			this.setInvalid(ruleTmpl, relPath(dir, event.Name), err)
+			return
+		}
+		err = this.setFromFile(ruleTmpl)
+		if err != nil {
+			log.Logger.Error("ERROR in fsnotify watcher. Templates might not update automatically", attributes.ErrorKey, err)
+		}
+
+	// fsnotify.Rename will have the template deleted, but a fsnotify.Create will also be received.
+	// Persisted templates are kept, see setFromFile.
+	case fsnotify.Remove, fsnotify.Rename:
+		if name, ok := partialName(dir, event.Name); ok {
+			this.clearInvalid(PartialsDir + "/" + name)
+			if this.getPersistence() != nil {
+				log.Logger.Info("Partial file removed, keeping stored partial", "partial", name)
+				return
+			}
+			this.mux.Lock()
+			delete(this.partials, name)
+			this.mux.Unlock()
+			this.revalidate(dir)
+			return
+		}
+		name, ok := templateName(dir, event.Name)
+		if !ok {
+			return
+		}
+		this.clearInvalid(name)
+		if this.getPersistence() != nil {
+			log.Logger.Info("Template file removed, keeping stored template", "template", name)
+			return
+		}
+		err := this.Delete(name)
+		if err != nil && !errors.Is(err, ErrTemplateNotFound) {
+			log.Logger.Error("ERROR in fsnotify watcher. Templates might not update automatically", attributes.ErrorKey, err)
+		}
+	}
+}
+
+// readTemplateFile reads and validates the JSON or YAML template in the file at path. The name of the
+// template is set even if an error is returned, see templateName.
+func readTemplateFile(dir string, path string) (tmpl Template, err error) {
+	name, _ := templateName(dir, path)
+	defer func() {
+		tmpl.Name = name
+	}()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return tmpl, err
+	}
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(b, &tmpl)
+	} else {
+		err = yaml.Unmarshal(b, &tmpl)
+	}
+	if err != nil {
+		return tmpl, err
+	}
+	return tmpl, tmpl.Validate()
+}
+
+func relPath(dir string, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Partials returns a copy of all partials by name.
+func (this *TemplateStore) Partials() map[string]string {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	result := make(map[string]string, len(this.partials))
+	for name, partial := range this.partials {
+		result[name] = partial
+	}
+	return result
+}
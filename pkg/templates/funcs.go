@@ -0,0 +1,145 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	_ "time/tzdata" // the runtime image has no timezone database
+
+	"github.com/SENERGY-Platform/models/go/models"
+	"github.com/lib/pq"
+)
+
+// FuncMap holds the functions available in command and delete templates, in addition to the
+// text/template builtins. It is used for rendering, validation and previews alike.
+var FuncMap = template.FuncMap{
+	"quoteIdent":    quoteIdent,
+	"quoteIdents":   quoteIdents,
+	"quoteLiteral":  quoteLiteral,
+	"hasColumn":     hasColumn,
+	"columnsExcept": columnsExcept,
+	"join":          join,
+	"shortId":       shortId,
+	"longId":        longId,
+	"timezone":      timezone,
+	"atTimeZone":    atTimeZone,
+	"utcOffset":     utcOffset,
+}
+
+// Parse parses t with the functions of FuncMap and the partials of the TemplateStore.
+func Parse(t string) (*template.Template, error) {
+	return newTemplate().Parse(t)
+}
+
+// newTemplate creates an empty template with the functions of FuncMap and the partials of the TemplateStore
+// as associated templates. The options are applied to all of them.
+func newTemplate(options ...string) *template.Template {
+	tmpl := template.New("").Option(options...).Funcs(FuncMap)
+	if singleton == nil {
+		return tmpl
+	}
+	for name, partial := range singleton.Partials() {
+		// partials are validated when loaded
+		_, _ = tmpl.New(name).Option(options...).Parse(partial)
+	}
+	return tmpl
+}
+
+// quoteIdent quotes s as SQL identifier, e.g. {{quoteIdent .Table}}.
+func quoteIdent(s string) string {
+	return pq.QuoteIdentifier(s)
+}
+
+// quoteIdents quotes each element of s as SQL identifier, e.g. {{.Columns | quoteIdents | join ", "}}.
+func quoteIdents(s []string) []string {
+	result := make([]string, len(s))
+	for i := range s {
+		result[i] = pq.QuoteIdentifier(s[i])
+	}
+	return result
+}
+
+// quoteLiteral quotes v as SQL string literal, e.g. {{quoteLiteral .Timezone}}.
+func quoteLiteral(v any) string {
+	return pq.QuoteLiteral(fmt.Sprint(v))
+}
+
+// hasColumn reports whether column is one of columns, e.g. {{if hasColumn .Columns "value"}}.
+func hasColumn(columns []string, column string) bool {
+	return slices.Contains(columns, column)
+}
+
+// columnsExcept returns columns without the given columns, e.g. {{columnsExcept .Columns "time"}}.
+func columnsExcept(columns []string, except ...string) []string {
+	result := []string{}
+	for _, column := range columns {
+		if !slices.Contains(except, column) {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// join joins items with sep. The items are the last argument to allow pipelines.
+func join(sep string, items []string) string {
+	return strings.Join(items, sep)
+}
+
+// shortId shortens a UUID, optionally with prefix like urn:infai:ses:device:, to the format used in table names.
+func shortId(id string) (string, error) {
+	return models.ShortenId(id)
+}
+
+// longId expands an id shortened by shortId to a UUID without prefix.
+func longId(id string) (string, error) {
+	if len(id) != 22 {
+		return "", errors.New("invalid short id " + id)
+	}
+	return models.LongId(id)
+}
+
+// timezone returns tz as SQL string literal if it is a known IANA timezone.
+func timezone(tz string) (string, error) {
+	_, err := time.LoadLocation(tz)
+	if err != nil {
+		return "", err
+	}
+	return pq.QuoteLiteral(tz), nil
+}
+
+// atTimeZone converts the timestamp column to the local time of tz, e.g. {{atTimeZone "time" .Timezone}}.
+func atTimeZone(column string, tz string) (string, error) {
+	literal, err := timezone(tz)
+	if err != nil {
+		return "", err
+	}
+	return pq.QuoteIdentifier(column) + " AT TIME ZONE " + literal, nil
+}
+
+// utcOffset returns the current offset of tz to UTC, e.g. +02:00.
+func utcOffset(tz string) (string, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return "", err
+	}
+	return time.Now().In(loc).Format("-07:00"), nil
+}
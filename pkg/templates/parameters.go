@@ -0,0 +1,216 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+)
+
+type ParameterType = string
+
+const ParameterTypeString ParameterType = "string"
+const ParameterTypeInteger ParameterType = "integer"
+const ParameterTypeNumber ParameterType = "number"
+const ParameterTypeBoolean ParameterType = "boolean"
+
+// Parameter declares a value that users set when creating a rule from the template.
+// The value is available in the command and delete template as .Params.<Name>.
+type Parameter struct {
+	Name          string        `json:"name"`
+	Description   string        `json:"description,omitempty"`
+	Type          ParameterType `json:"type"`
+	Default       any           `json:"default,omitempty"` // the parameter is required if no default is set
+	AllowedValues []any         `json:"allowed_values,omitempty"`
+	Min           *float64      `json:"min,omitempty"`     // only for integer and number
+	Max           *float64      `json:"max,omitempty"`     // only for integer and number
+	Pattern       string        `json:"pattern,omitempty"` // only for string, regular expression the whole value has to match
+}
+
+// safeStringValue is the charset of string values that are not in the allowed values of their parameter.
+// Rules from templates may be created by non-admins and the values are rendered into SQL as they are, so
+// quotes, semicolons, comments and the like are never allowed.
+var safeStringValue = regexp.MustCompile(`^[A-Za-z0-9 _.:/+]*$`)
+
+// ValidateParameters checks the parameter declarations of the template.
+func (t Template) ValidateParameters() error {
+	names := map[string]bool{}
+	for _, p := range t.Parameters {
+		if len(p.Name) == 0 {
+			return errors.New("parameter without name")
+		}
+		if names[p.Name] {
+			return errors.New("duplicate parameter " + p.Name)
+		}
+		names[p.Name] = true
+		switch p.Type {
+		case ParameterTypeString, ParameterTypeInteger, ParameterTypeNumber, ParameterTypeBoolean:
+		default:
+			return errors.New("parameter " + p.Name + " has unknown type " + p.Type)
+		}
+		if p.Type == ParameterTypeString && len(p.AllowedValues) == 0 && len(p.Pattern) == 0 {
+			return errors.New("string parameter " + p.Name + " needs allowed_values or a pattern")
+		}
+		if len(p.Pattern) > 0 {
+			if p.Type != ParameterTypeString {
+				return errors.New("parameter " + p.Name + " has a pattern but is not a string")
+			}
+			_, err := p.pattern()
+			if err != nil {
+				return errors.New("pattern of parameter " + p.Name + ": " + err.Error())
+			}
+		}
+		for _, allowed := range p.AllowedValues {
+			_, err := p.convert(allowed)
+			if err != nil {
+				return errors.New("allowed value of parameter " + p.Name + ": " + err.Error())
+			}
+		}
+		if p.Default != nil {
+			_, err := p.resolve(p.Default)
+			if err != nil {
+				return errors.New("default of parameter " + p.Name + ": " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveParameters validates values against the parameter declarations of the template and fills in defaults.
+func (t Template) ResolveParameters(values map[string]any) (map[string]any, error) {
+	result := map[string]any{}
+	for name := range values {
+		if !slices.ContainsFunc(t.Parameters, func(p Parameter) bool { return p.Name == name }) {
+			return nil, errors.New("unknown parameter " + name)
+		}
+	}
+	for _, p := range t.Parameters {
+		value, ok := values[p.Name]
+		if !ok || value == nil {
+			if p.Default == nil {
+				return nil, errors.New("missing parameter " + p.Name)
+			}
+			value = p.Default
+		}
+		resolved, err := p.resolve(value)
+		if err != nil {
+			return nil, errors.New("parameter " + p.Name + ": " + err.Error())
+		}
+		result[p.Name] = resolved
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// resolve converts value to the type of the parameter and checks the allowed values and range.
+func (p Parameter) resolve(value any) (any, error) {
+	converted, err := p.convert(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.AllowedValues) > 0 {
+		allowed := false
+		for _, a := range p.AllowedValues {
+			a, _ = p.convert(a)
+			if a == converted {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("value %v is not allowed", value)
+		}
+	} else if s, ok := converted.(string); ok {
+		pattern, err := p.pattern()
+		if err != nil {
+			return nil, err
+		}
+		if !pattern.MatchString(s) {
+			return nil, fmt.Errorf("value %v does not match the pattern %v", value, p.Pattern)
+		}
+		if !safeStringValue.MatchString(s) {
+			return nil, fmt.Errorf("value %v may only contain letters, digits, spaces and _.:/+", value)
+		}
+	}
+	var f float64
+	switch v := converted.(type) {
+	case int64:
+		f = float64(v)
+	case float64:
+		f = v
+	default:
+		return converted, nil
+	}
+	if p.Min != nil && f < *p.Min {
+		return nil, fmt.Errorf("value %v is less than %v", value, *p.Min)
+	}
+	if p.Max != nil && f > *p.Max {
+		return nil, fmt.Errorf("value %v is greater than %v", value, *p.Max)
+	}
+	return converted, nil
+}
+
+// convert converts value to string, int64, float64 or bool according to the type of the parameter.
+func (p Parameter) convert(value any) (any, error) {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return nil, err
+		}
+		value = f
+	}
+	if i, ok := value.(int); ok {
+		value = float64(i)
+	}
+	if i, ok := value.(int64); ok {
+		value = float64(i)
+	}
+	switch p.Type {
+	case ParameterTypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case ParameterTypeBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case ParameterTypeNumber:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+	case ParameterTypeInteger:
+		if f, ok := value.(float64); ok && f == math.Trunc(f) {
+			return int64(f), nil
+		}
+	}
+	return nil, fmt.Errorf("value %v is not of type %v", value, p.Type)
+}
+
+// pattern compiles the pattern of the parameter, anchored to match the whole value.
+// An empty pattern matches no value, see ValidateParameters.
+func (p Parameter) pattern() (*regexp.Regexp, error) {
+	if len(p.Pattern) == 0 {
+		return nil, errors.New("parameter " + p.Name + " has neither allowed values nor a pattern")
+	}
+	return regexp.Compile("^(?:" + p.Pattern + ")$")
+}
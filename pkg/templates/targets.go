@@ -0,0 +1,120 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package templates
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
+)
+
+// Target is a family of tables template rules can be created for. Template rules for a target
+// apply to all tables matching the TableRegEx of the target.
+type Target = config.TemplateRuleTarget
+
+const TargetDevice = "device"
+const TargetExport = "export"
+
+// EditableFields lists the fields of template rules that can be restricted per target.
+var EditableFields = []string{"users", "roles", "template", "parameters", "target"}
+
+var defaultTargets = []Target{
+	{Name: TargetDevice, TableRegEx: "^device:.{22}_service:.{22}$"},
+	{Name: TargetExport, TableRegEx: "^userid:.{22}_export:.{22}$"},
+}
+
+// setTargets replaces the targets of the store with the default targets and the given targets.
+// Targets with the name of a default target replace the default target. Invalid targets are skipped.
+func (this *TemplateStore) setTargets(targets []Target) error {
+	result := map[string]Target{}
+	for _, target := range defaultTargets {
+		result[target.Name] = target
+	}
+	errs := []error{}
+	for _, target := range targets {
+		err := ValidateTarget(target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result[target.Name] = target
+	}
+	this.mux.Lock()
+	this.targets = result
+	this.mux.Unlock()
+	return errors.Join(errs...)
+}
+
+// ValidateTarget checks that the target has a name, a valid TableRegEx and only known editable fields.
+func ValidateTarget(target Target) error {
+	if len(target.Name) == 0 {
+		return errors.New("template rule target without name")
+	}
+	if len(target.TableRegEx) == 0 {
+		return errors.New("template rule target " + target.Name + " without table_reg_ex")
+	}
+	_, err := regexp.Compile(target.TableRegEx)
+	if err != nil {
+		return errors.New("template rule target " + target.Name + ": " + err.Error())
+	}
+	for _, field := range target.EditableFields {
+		if !slices.Contains(EditableFields, field) {
+			return errors.New("template rule target " + target.Name + " has unknown editable field " + field)
+		}
+	}
+	return nil
+}
+
+// Target returns the target with the given name.
+func (this *TemplateStore) Target(name string) (target Target, ok bool) {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	target, ok = this.targets[name]
+	return target, ok
+}
+
+// TargetForTableRegEx returns the target using the given TableRegEx.
+func (this *TemplateStore) TargetForTableRegEx(tableRegEx string) (target Target, ok bool) {
+	for _, target := range this.Targets() {
+		if target.TableRegEx == tableRegEx {
+			return target, true
+		}
+	}
+	return target, false
+}
+
+// Targets returns all targets sorted by name.
+func (this *TemplateStore) Targets() []Target {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	result := make([]Target, 0, len(this.targets))
+	for _, target := range this.targets {
+		result = append(result, target)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// IsEditable reports whether non-admins may change the given field of template rules for the target.
+func IsEditable(target Target, field string) bool {
+	return len(target.EditableFields) == 0 || slices.Contains(target.EditableFields, field)
+}
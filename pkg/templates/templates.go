@@ -17,9 +17,10 @@
 package templates
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"os"
+	"reflect"
 	"strings"
 	"sync"
 
@@ -30,20 +31,58 @@ import (
 )
 
 type Template struct {
-	CommandTemplate string `json:"command_template"`
-	DeleteTemplate  string `json:"delete_template"`
-	Description     string `json:"description"`
-	Priority        int    `json:"priority"`
-	Group           string `json:"group"`
+	Name            string      `sqltype:"text" sqlextra:"primary key" json:"name,omitempty"` // Set by the store
+	CommandTemplate string      `sqltype:"text" json:"command_template"`
+	DeleteTemplate  string      `sqltype:"text" json:"delete_template"`
+	Description     string      `sqltype:"text" json:"description"`
+	Priority        int         `sqltype:"integer" json:"priority"`
+	Group           string      `sqltype:"text" json:"group"`
+	Parameters      []Parameter `sqltype:"jsonb" json:"parameters,omitempty"`
+	Version         int64       `sqltype:"bigint" sqlextra:"not null default 1" json:"version"`                 // Incremented by the store on each change
+	DependsOn       []string    `sqltype:"text[]" sqlextra:"not null default '{}'" json:"depends_on,omitempty"` // Groups applied before and deleted after the group of this template
+}
+
+// Partial is a template fragment, see PartialsDir.
+type Partial struct {
+	Name     string `sqltype:"text" sqlextra:"primary key" json:"name"`
+	Template string `sqltype:"text" json:"template"`
+}
+
+// Persistence stores templates for all instances. Changes made by any instance are announced to the
+// listeners of all instances.
+type Persistence interface {
+	ListTemplates() (templates []Template, err error)
+	GetTemplate(name string) (template *Template, err error) // template is nil if it does not exist
+	InsertTemplateIfMissing(template Template) (err error)
+	SetTemplate(template Template) (stored Template, err error)    // increments the version if the template changed, see TemplateStore.Set
+	CreateTemplate(template Template) (err error)                  // returns ErrTemplateExists if the template exists
+	UpdateTemplate(template Template) (stored Template, err error) // like SetTemplate, returns ErrTemplateNotFound if the template does not exist
+	DeleteTemplate(name string) (err error)
+	ListPartials() (partials []Partial, err error)
+	InsertPartialIfMissing(partial Partial) (err error)
+	// ListenTemplateChanges calls onChange with the name of each changed template. Changed partials are
+	// announced with their name prefixed by PartialsDir and a slash.
+	// The name is empty if changes might have been missed and all templates should be reloaded.
+	ListenTemplateChanges(ctx context.Context, wg *sync.WaitGroup, onChange func(name string)) (err error)
 }
 
 type TemplateStore struct {
-	Templates map[string]Template
-	mux       sync.Mutex
+	templates   map[string]Template
+	invalid     map[string]TemplateInfo
+	partials    map[string]string
+	targets     map[string]Target
+	mux         sync.RWMutex
+	persistence Persistence
 }
 
+var ErrTemplateNotFound = errors.New("template not found")
+var ErrTemplateExists = errors.New("template already exists")
+
 var singleton *TemplateStore
 
+// New creates the TemplateStore with the configured template rule targets and reads the templates
+// and partials of the TemplateDir, if configured. Templates that can not be read or are invalid are
+// skipped and reported by Status. The store is returned even if reading the TemplateDir failed.
 func New(c *config.Config) (*TemplateStore, error) {
 	if singleton != nil {
 		return singleton, nil
@@ -51,37 +90,28 @@ func New(c *config.Config) (*TemplateStore, error) {
 	if c == nil {
 		return nil, errors.New("config can only be nil if singleton has been created with config")
 	}
-	singleton = &TemplateStore{Templates: make(map[string]Template), mux: sync.Mutex{}}
-	log.Logger.Info("Reading templates", "dir", c.TemplateDir)
-	files, err := os.ReadDir(c.TemplateDir)
+	singleton = &TemplateStore{templates: make(map[string]Template), invalid: make(map[string]TemplateInfo), partials: make(map[string]string), mux: sync.RWMutex{}}
+	err := singleton.setTargets(c.TemplateRuleTargets)
 	if err != nil {
-		return nil, err
+		log.Logger.Warn("Ignoring invalid template rule targets", attributes.ErrorKey, err)
 	}
-	singleton.mux.Lock()
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
-			log.Logger.Info("Ignoring template: is dir or does not end in .json", "file", file.Name())
-			continue
-		}
-		tmpl, err := os.ReadFile(c.TemplateDir + "/" + file.Name())
-		if err != nil {
-			return nil, err
-		}
-		var ruleTmpl Template
-		err = json.Unmarshal(tmpl, &ruleTmpl)
-		if err != nil {
-			return nil, err
-		}
-		singleton.Templates[strings.TrimSuffix(file.Name(), ".json")] = ruleTmpl
+	if len(c.TemplateDir) == 0 {
+		log.Logger.Info("No template dir configured")
+		return singleton, nil
+	}
+	log.Logger.Info("Reading templates", "dir", c.TemplateDir)
+	dirs, loadErrors, err := singleton.loadDir(c.TemplateDir, c.TemplateDir)
+	if err != nil {
+		return singleton, err
 	}
-	singleton.mux.Unlock()
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return nil, err
+		return singleton, errors.Join(append(loadErrors, err)...)
 	}
 
 	// Start listening for events.
+	store := singleton
 	go func() {
 		for {
 			select {
@@ -90,38 +120,7 @@ func New(c *config.Config) (*TemplateStore, error) {
 					return
 				}
 				log.Logger.Debug("fsnotify event", "event", event)
-				if !strings.HasSuffix(event.Name, ".json") {
-					log.Logger.Debug("Ignoring template: does not end in .json", "file", event.Name)
-					continue
-				}
-				switch event.Op {
-				// A new pathname was created.
-				case fsnotify.Create, fsnotify.Write:
-					if strings.HasPrefix(event.Name, c.TemplateDir) {
-						singleton.mux.Lock()
-						var ruleTmpl Template
-						tmpl, err := os.ReadFile(event.Name)
-						if err != nil {
-							log.Logger.Error("ERROR in fsnotify watcher. Templates might not update automatically", attributes.ErrorKey, err)
-							continue
-						}
-						err = json.Unmarshal(tmpl, &ruleTmpl)
-						if err != nil {
-							log.Logger.Error("ERROR in fsnotify watcher. Templates might not update automatically", attributes.ErrorKey, err)
-							continue
-						}
-						singleton.Templates[strings.TrimSuffix(strings.TrimPrefix(event.Name, c.TemplateDir+"/"), ".json")] = ruleTmpl
-						singleton.mux.Unlock()
-					}
-
-				// fsnotify.Rename will have the template deleted, but a fsnotify.Create will also be received
-				case fsnotify.Remove, fsnotify.Rename:
-					if strings.HasPrefix(event.Name, c.TemplateDir) {
-						singleton.mux.Lock()
-						delete(singleton.Templates, strings.TrimSuffix(strings.TrimPrefix(event.Name, c.TemplateDir+"/"), ".json"))
-						singleton.mux.Unlock()
-					}
-				}
+				store.handleFileEvent(c.TemplateDir, watcher, event)
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
@@ -132,10 +131,303 @@ func New(c *config.Config) (*TemplateStore, error) {
 		}
 	}()
 
-	// Add a path.
-	err = watcher.Add(c.TemplateDir)
+	// Add all paths, fsnotify does not watch recursively.
+	for _, dir := range dirs {
+		err = watcher.Add(dir)
+		if err != nil {
+			loadErrors = append(loadErrors, err)
+		}
+	}
+	return singleton, errors.Join(loadErrors...)
+}
+
+// UsePersistence seeds the persistence with the partials and templates read so far, if they are missing
+// there, and replaces all partials and templates of the store with the persisted ones. Afterward, all
+// changes are made through the persistence and changes of other instances are received. Changed files
+// only insert missing partials and templates and removed files are ignored.
+func (this *TemplateStore) UsePersistence(persistence Persistence, ctx context.Context, wg *sync.WaitGroup) error {
+	for name, partial := range this.Partials() {
+		err := persistence.InsertPartialIfMissing(Partial{Name: name, Template: partial})
+		if err != nil {
+			return err
+		}
+	}
+	for _, tmpl := range this.List() {
+		err := persistence.InsertTemplateIfMissing(tmpl)
+		if err != nil {
+			return err
+		}
+	}
+	this.mux.Lock()
+	this.persistence = persistence
+	this.mux.Unlock()
+	err := persistence.ListenTemplateChanges(ctx, wg, func(name string) {
+		var err error
+		if len(name) == 0 || strings.HasPrefix(name, PartialsDir+"/") {
+			// templates using a changed partial need to be validated again
+			err = this.reload()
+		} else {
+			err = this.reloadTemplate(name)
+		}
+		if err != nil {
+			log.Logger.Error("could not reload templates. Templates might not update automatically", attributes.ErrorKey, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return this.reload()
+}
+
+// Get returns the template with the given name.
+func (this *TemplateStore) Get(name string) (tmpl Template, ok bool) {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	tmpl, ok = this.templates[name]
+	return tmpl, ok
+}
+
+// List returns a copy of all templates by name.
+func (this *TemplateStore) List() map[string]Template {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	result := make(map[string]Template, len(this.templates))
+	for name, tmpl := range this.templates {
+		result[name] = tmpl
+	}
+	return result
+}
+
+// Set creates or replaces the template with the name of tmpl and returns the stored template.
+// The version is incremented if the template changed, but never lowered below the version of tmpl.
+func (this *TemplateStore) Set(tmpl Template) (Template, error) {
+	if len(tmpl.Name) == 0 {
+		return tmpl, errors.New("missing template name")
+	}
+	persistence := this.getPersistence()
+	if persistence != nil {
+		tmpl.Version = max(tmpl.Version, 1)
+		stored, err := persistence.SetTemplate(tmpl)
+		if err != nil {
+			return tmpl, err
+		}
+		tmpl = stored
+	} else {
+		current, exists := this.Get(tmpl.Name)
+		tmpl.Version = nextVersion(current, exists, tmpl)
+	}
+	this.clearInvalid(tmpl.Name)
+	this.put(tmpl)
+	return tmpl, nil
+}
+
+// Create stores a new template and returns the stored template. Returns ErrTemplateExists if a template with the name
+// of tmpl exists.
+func (this *TemplateStore) Create(tmpl Template) (Template, error) {
+	if len(tmpl.Name) == 0 {
+		return tmpl, errors.New("missing template name")
+	}
+	tmpl.Version = max(tmpl.Version, 1)
+	persistence := this.getPersistence()
+	if persistence != nil {
+		err := persistence.CreateTemplate(tmpl)
+		if err != nil {
+			return tmpl, err
+		}
+		this.clearInvalid(tmpl.Name)
+		this.put(tmpl)
+		return tmpl, nil
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, exists := this.templates[tmpl.Name]; exists {
+		return tmpl, ErrTemplateExists
+	}
+	delete(this.invalid, tmpl.Name)
+	this.templates[tmpl.Name] = tmpl
+	return tmpl, nil
+}
+
+// Update replaces the template with the name of tmpl and returns the stored template. The version is incremented like
+// in Set. Returns ErrTemplateNotFound if the template does not exist.
+func (this *TemplateStore) Update(tmpl Template) (Template, error) {
+	persistence := this.getPersistence()
+	if persistence != nil {
+		tmpl.Version = max(tmpl.Version, 1)
+		stored, err := persistence.UpdateTemplate(tmpl)
+		if err != nil {
+			return tmpl, err
+		}
+		this.clearInvalid(stored.Name)
+		this.put(stored)
+		return stored, nil
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	current, exists := this.templates[tmpl.Name]
+	if !exists {
+		return tmpl, ErrTemplateNotFound
+	}
+	tmpl.Version = nextVersion(current, exists, tmpl)
+	delete(this.invalid, tmpl.Name)
+	this.templates[tmpl.Name] = tmpl
+	return tmpl, nil
+}
+
+func nextVersion(current Template, exists bool, tmpl Template) int64 {
+	if !exists {
+		return max(tmpl.Version, 1)
+	}
+	requested := tmpl.Version
+	tmpl.Version = current.Version
+	if reflect.DeepEqual(current.normalized(), tmpl.normalized()) {
+		return current.Version
+	}
+	return max(requested, current.Version+1)
+}
+
+// normalized returns the template as decoded from JSON without options, as numbers in parameters may be
+// json.Number, int64 or float64 depending on where the template was read from.
+func (t Template) normalized() Template {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return t
+	}
+	result := Template{}
+	err = json.Unmarshal(b, &result)
+	if err != nil {
+		return t
+	}
+	return result
+}
+
+// Delete removes the template with the given name.
+func (this *TemplateStore) Delete(name string) error {
+	persistence := this.getPersistence()
+	if persistence != nil {
+		err := persistence.DeleteTemplate(name)
+		if err != nil {
+			return err
+		}
+	} else if _, ok := this.Get(name); !ok {
+		return ErrTemplateNotFound
+	}
+	this.mux.Lock()
+	delete(this.templates, name)
+	this.mux.Unlock()
+	return nil
+}
+
+// Status returns all valid and invalid templates by name. If a template file is invalid, but a valid
+// template of the same name is stored, the valid template is returned with the error of the file.
+func (this *TemplateStore) Status() map[string]TemplateInfo {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	result := make(map[string]TemplateInfo, len(this.templates)+len(this.invalid))
+	for name, info := range this.invalid {
+		result[name] = info
+	}
+	for name, tmpl := range this.templates {
+		info := TemplateInfo{Template: tmpl, Status: TemplateStatusValid}
+		if invalid, ok := this.invalid[name]; ok {
+			info.Error = invalid.Error
+			info.File = invalid.File
+		}
+		result[name] = info
+	}
+	return result
+}
+
+// setInvalid records that tmpl could not be loaded from file. The template is not changed in the store.
+func (this *TemplateStore) setInvalid(tmpl Template, file string, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.invalid[tmpl.Name] = TemplateInfo{Template: tmpl, Status: TemplateStatusInvalid, Error: err.Error(), File: file}
+}
+
+func (this *TemplateStore) clearInvalid(name string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	delete(this.invalid, name)
+}
+
+func (this *TemplateStore) put(tmpl Template) {
+	this.mux.Lock()
+	this.templates[tmpl.Name] = tmpl
+	this.mux.Unlock()
+}
+
+func (this *TemplateStore) getPersistence() Persistence {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	return this.persistence
+}
+
+// reload replaces all partials and templates with the persisted ones. The templates are validated with
+// the reloaded partials.
+func (this *TemplateStore) reload() error {
+	partialList, err := this.getPersistence().ListPartials()
+	if err != nil {
+		return err
+	}
+	partials := make(map[string]string, len(partialList))
+	for _, partial := range partialList {
+		partials[partial.Name] = partial.Template
+	}
+	this.mux.Lock()
+	this.partials = partials
+	this.mux.Unlock()
+	list, err := this.getPersistence().ListTemplates()
+	if err != nil {
+		return err
+	}
+	templates := make(map[string]Template, len(list))
+	invalid := map[string]TemplateInfo{}
+	for _, tmpl := range list {
+		err = tmpl.Validate()
+		if err != nil {
+			log.Logger.Warn("Ignoring invalid stored template", "template", tmpl.Name, attributes.ErrorKey, err)
+			invalid[tmpl.Name] = TemplateInfo{Template: tmpl, Status: TemplateStatusInvalid, Error: err.Error()}
+			continue
+		}
+		templates[tmpl.Name] = tmpl
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for name, info := range this.invalid {
+		if len(info.File) > 0 {
+			invalid[name] = info
+		}
+	}
+	this.templates = templates
+	this.invalid = invalid
+	return nil
+}
+
+func (this *TemplateStore) reloadTemplate(name string) error {
+	tmpl, err := this.getPersistence().GetTemplate(name)
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		// validated before locking, rendering reads the partials
+		err = tmpl.Validate()
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if info, ok := this.invalid[name]; ok && len(info.File) == 0 {
+		delete(this.invalid, name)
+	}
+	if tmpl == nil {
+		delete(this.templates, name)
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		log.Logger.Warn("Ignoring invalid stored template", "template", name, attributes.ErrorKey, err)
+		delete(this.templates, name)
+		this.invalid[name] = TemplateInfo{Template: *tmpl, Status: TemplateStatusInvalid, Error: err.Error()}
+		return nil
 	}
-	return singleton, nil
+	this.templates[name] = *tmpl
+	return nil
 }
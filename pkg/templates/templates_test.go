@@ -0,0 +1,532 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/config"
+	"github.com/SENERGY-Platform/timescale-rule-manager/pkg/log"
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Template{
+		Name:            "valid",
+		CommandTemplate: "CREATE VIEW \"{{.Table}}_{{.Params.interval}}\" AS SELECT {{range .Columns}}{{.}}, {{end}}1;",
+		DeleteTemplate:  "DROP VIEW \"{{.Table}}_{{.Params.interval}}\";",
+		Parameters:      []Parameter{{Name: "interval", Type: ParameterTypeString, AllowedValues: []any{"1d", "1w"}}},
+	}
+	err := valid.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tmpl := range map[string]Template{
+		"syntax":          {CommandTemplate: "{{.Table", DeleteTemplate: ""},
+		"unknown field":   {CommandTemplate: "{{.Tabel}}", DeleteTemplate: ""},
+		"unknown param":   {CommandTemplate: "", DeleteTemplate: "{{.Params.interval}}"},
+		"invalid default": {Parameters: []Parameter{{Name: "n", Type: ParameterTypeInteger, Default: "one"}}},
+		"free string":     {Parameters: []Parameter{{Name: "s", Type: ParameterTypeString}}},
+		"invalid pattern": {Parameters: []Parameter{{Name: "s", Type: ParameterTypeString, Pattern: "("}}},
+		"number pattern":  {Parameters: []Parameter{{Name: "n", Type: ParameterTypeNumber, Pattern: "1"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if tmpl.Validate() == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestResolveStringParameters(t *testing.T) {
+	tmpl := Template{Parameters: []Parameter{
+		{Name: "interval", Type: ParameterTypeString, Pattern: "[0-9]+ (minutes|hours|days)"},
+		{Name: "zone", Type: ParameterTypeString, Pattern: ".*", Default: "UTC"},
+	}}
+	for value, ok := range map[string]bool{
+		"15 minutes":              true,
+		"1 hour":                  false,
+		"1 days'; DROP TABLE x--": false,
+		"x 1 days":                false,
+	} {
+		_, err := tmpl.ResolveParameters(map[string]any{"interval": value})
+		if ok && err != nil {
+			t.Error(value, err)
+		}
+		if !ok && err == nil {
+			t.Error(value, "expected error")
+		}
+	}
+	for value, ok := range map[string]bool{
+		"Europe/Berlin":  true,
+		"+01:00":         true,
+		"UTC'::text; --": false,
+		"UTC\"; DROP x;": false,
+	} {
+		_, err := tmpl.ResolveParameters(map[string]any{"interval": "1 days", "zone": value})
+		if ok && err != nil {
+			t.Error(value, err)
+		}
+		if !ok && err == nil {
+			t.Error(value, "expected error")
+		}
+	}
+}
+
+func TestNewSkipsInvalidFiles(t *testing.T) {
+	log.InitForTest()
+	singleton = nil
+	defer func() {
+		singleton = nil
+	}()
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json": "{\"command_template\": \"{{.Table\"}",
+		"b.json": "not json",
+		"c.json": "{\"command_template\": \"SELECT 1;\", \"delete_template\": \"SELECT 2;\"}",
+	}
+	for name, content := range files {
+		err := os.WriteFile(dir+"/"+name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts, err := New(&config.Config{TemplateDir: dir})
+	if err == nil {
+		t.Error("expected load errors")
+	}
+	if _, ok := ts.Get("c"); !ok {
+		t.Error("valid template not loaded")
+	}
+	status := ts.Status()
+	for _, name := range []string{"a", "b"} {
+		if _, ok := ts.Get(name); ok {
+			t.Error("invalid template loaded", name)
+		}
+		if status[name].Status != TemplateStatusInvalid || len(status[name].Error) == 0 {
+			t.Error("invalid template not reported", name, status[name])
+		}
+	}
+	if status["c"].Status != TemplateStatusValid {
+		t.Error("valid template not reported", status["c"])
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	tmpl, err := Parse(`SELECT {{columnsExcept .Columns "time" | quoteIdents | join ", "}}, {{atTimeZone "time" .Timezone}} FROM {{quoteIdent .Table}} WHERE {{if hasColumn .Columns "unit"}}unit = {{quoteLiteral "it's"}}{{end}};{{longId (shortId "urn:infai:ses:device:ec85317b-6b14-4f7d-9d45-70198735dccf")}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, map[string]any{
+		"Table":    "a\"b",
+		"Columns":  []string{"time", "value", "unit"},
+		"Timezone": "Europe/Berlin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT "value", "unit", "time" AT TIME ZONE 'Europe/Berlin' FROM "a""b" WHERE unit = 'it''s';ec85317b-6b14-4f7d-9d45-70198735dccf`
+	if buf.String() != expected {
+		t.Error("unexpected result", buf.String())
+	}
+	_, err = timezone("Nowhere/Somewhere")
+	if err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+	_, err = longId("short")
+	if err == nil {
+		t.Error("expected error for invalid short id")
+	}
+}
+
+func TestNewReadsSubdirectoriesAndPartials(t *testing.T) {
+	log.InitForTest()
+	singleton = nil
+	defer func() {
+		singleton = nil
+	}()
+	dir := t.TempDir()
+	files := map[string]string{
+		"top.json":               "{\"command_template\": \"SELECT 1;\", \"delete_template\": \"SELECT 2;\"}",
+		"aggregates/hourly.yaml": "command_template: |\n  SELECT {{template \"columns\" .}}\n  FROM {{quoteIdent .Table}};\ndelete_template: SELECT 2;\ngroup: aggregates\n",
+		"aggregates/daily.yml":   "command_template: SELECT {{template \"missing\" .}};\ndelete_template: SELECT 2;\n",
+		"partials/columns.tmpl":  "{{.Columns | quoteIdents | join \", \"}}",
+		"aggregates/ignored.txt": "not a template",
+		"partials/nested/x.sql":  "1",
+	}
+	for name, content := range files {
+		err := os.MkdirAll(filepath.Dir(dir+"/"+name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(dir+"/"+name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts, _ := New(&config.Config{TemplateDir: dir})
+	if _, ok := ts.Get("top"); !ok {
+		t.Error("top level template not loaded")
+	}
+	hourly, ok := ts.Get("aggregates/hourly")
+	if !ok {
+		t.Fatal("template of subdirectory not loaded")
+	}
+	if hourly.Group != "aggregates" {
+		t.Error("yaml not decoded", hourly)
+	}
+	if _, ok := ts.Get("aggregates/daily"); ok {
+		t.Error("template using missing partial loaded")
+	}
+	if _, ok := ts.Get("partials/columns"); ok {
+		t.Error("partial loaded as template")
+	}
+	partials := ts.Partials()
+	if len(partials) != 2 || len(partials["columns"]) == 0 || partials["nested/x"] != "1" {
+		t.Error("unexpected partials", partials)
+	}
+	tmpl, err := Parse(hourly.CommandTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, map[string]any{"Table": "t", "Columns": []string{"time", "value"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "SELECT \"time\", \"value\"\nFROM \"t\";\n" {
+		t.Error("unexpected result", buf.String())
+	}
+}
+
+type memPersistence struct {
+	templates map[string]Template
+	partials  map[string]string
+	onChange  func(name string)
+	mux       sync.Mutex
+}
+
+func newMemPersistence() *memPersistence {
+	return &memPersistence{templates: map[string]Template{}, partials: map[string]string{}}
+}
+
+// notify calls the listener like a notification of the database would.
+func (this *memPersistence) notify(name string) {
+	if this.onChange != nil {
+		this.onChange(name)
+	}
+}
+
+func (this *memPersistence) ListTemplates() (list []Template, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for _, tmpl := range this.templates {
+		list = append(list, tmpl)
+	}
+	return list, nil
+}
+
+func (this *memPersistence) GetTemplate(name string) (*Template, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	tmpl, ok := this.templates[name]
+	if !ok {
+		return nil, nil
+	}
+	return &tmpl, nil
+}
+
+func (this *memPersistence) InsertTemplateIfMissing(tmpl Template) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, ok := this.templates[tmpl.Name]; !ok {
+		this.templates[tmpl.Name] = tmpl
+	}
+	return nil
+}
+
+func (this *memPersistence) SetTemplate(tmpl Template) (Template, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	current, exists := this.templates[tmpl.Name]
+	tmpl.Version = nextVersion(current, exists, tmpl)
+	this.templates[tmpl.Name] = tmpl
+	return tmpl, nil
+}
+
+func (this *memPersistence) CreateTemplate(tmpl Template) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, ok := this.templates[tmpl.Name]; ok {
+		return ErrTemplateExists
+	}
+	this.templates[tmpl.Name] = tmpl
+	return nil
+}
+
+func (this *memPersistence) UpdateTemplate(tmpl Template) (Template, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	current, exists := this.templates[tmpl.Name]
+	if !exists {
+		return tmpl, ErrTemplateNotFound
+	}
+	tmpl.Version = nextVersion(current, exists, tmpl)
+	this.templates[tmpl.Name] = tmpl
+	return tmpl, nil
+}
+
+func (this *memPersistence) DeleteTemplate(name string) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, ok := this.templates[name]; !ok {
+		return ErrTemplateNotFound
+	}
+	delete(this.templates, name)
+	return nil
+}
+
+func (this *memPersistence) ListPartials() (list []Partial, err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for name, partial := range this.partials {
+		list = append(list, Partial{Name: name, Template: partial})
+	}
+	return list, nil
+}
+
+func (this *memPersistence) InsertPartialIfMissing(partial Partial) error {
+	this.mux.Lock()
+	_, exists := this.partials[partial.Name]
+	if !exists {
+		this.partials[partial.Name] = partial.Template
+	}
+	this.mux.Unlock()
+	if !exists {
+		this.notify(PartialsDir + "/" + partial.Name)
+	}
+	return nil
+}
+
+func (this *memPersistence) ListenTemplateChanges(_ context.Context, _ *sync.WaitGroup, onChange func(name string)) error {
+	this.onChange = onChange
+	return nil
+}
+
+func TestFileEventsSeedPersistence(t *testing.T) {
+	log.InitForTest()
+	singleton = nil
+	defer func() {
+		singleton = nil
+	}()
+	dir := t.TempDir()
+	file := func(name string, content string) string {
+		err := os.WriteFile(dir+"/"+name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir + "/" + name
+	}
+	a := file("a.json", "{\"command_template\": \"SELECT 1;\", \"delete_template\": \"SELECT 2;\"}")
+	ts, err := New(&config.Config{TemplateDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	persistence := newMemPersistence()
+	err = ts.UsePersistence(persistence, context.Background(), &sync.WaitGroup{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited, err := ts.Set(Template{Name: "a", CommandTemplate: "SELECT 3;", DeleteTemplate: "SELECT 4;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file("a.json", "{\"command_template\": \"SELECT 5;\", \"delete_template\": \"SELECT 6;\"}")
+	ts.handleFileEvent(dir, nil, fsnotify.Event{Name: a, Op: fsnotify.Write})
+	if tmpl, _ := persistence.GetTemplate("a"); tmpl == nil || tmpl.CommandTemplate != edited.CommandTemplate {
+		t.Error("stored template overwritten by file", tmpl)
+	}
+	if tmpl, _ := ts.Get("a"); tmpl.CommandTemplate != edited.CommandTemplate {
+		t.Error("template overwritten by file", tmpl)
+	}
+
+	b := file("b.json", "{\"command_template\": \"SELECT 7;\", \"delete_template\": \"SELECT 8;\"}")
+	ts.handleFileEvent(dir, nil, fsnotify.Event{Name: b, Op: fsnotify.Create})
+	if tmpl, _ := persistence.GetTemplate("b"); tmpl == nil || tmpl.Version != 1 {
+		t.Error("new template file not inserted", tmpl)
+	}
+	if _, ok := ts.Get("b"); !ok {
+		t.Error("new template file not loaded")
+	}
+
+	err = os.Remove(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.handleFileEvent(dir, nil, fsnotify.Event{Name: a, Op: fsnotify.Remove})
+	if tmpl, _ := persistence.GetTemplate("a"); tmpl == nil {
+		t.Error("stored template deleted by file removal")
+	}
+	if _, ok := ts.Get("a"); !ok {
+		t.Error("template deleted by file removal")
+	}
+}
+
+func TestPartialChanges(t *testing.T) {
+	log.InitForTest()
+	singleton = nil
+	defer func() {
+		singleton = nil
+	}()
+	dir := t.TempDir()
+	err := os.MkdirAll(dir+"/"+PartialsDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir+"/t.json", []byte("{\"command_template\": \"SELECT {{template \\\"columns\\\" .}};\", \"delete_template\": \"SELECT 2;\"}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := New(&config.Config{TemplateDir: dir})
+	if _, ok := ts.Get("t"); ok {
+		t.Fatal("template using missing partial loaded")
+	}
+
+	partial := dir + "/" + PartialsDir + "/columns.tmpl"
+	err = os.WriteFile(partial, []byte("{{.Columns | join \", \"}}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.handleFileEvent(dir, nil, fsnotify.Event{Name: partial, Op: fsnotify.Create})
+	if _, ok := ts.Get("t"); !ok {
+		t.Error("template not loaded after partial was added", ts.Status()["t"])
+	}
+
+	err = os.Remove(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.handleFileEvent(dir, nil, fsnotify.Event{Name: partial, Op: fsnotify.Remove})
+	if _, ok := ts.Get("t"); ok {
+		t.Error("template still valid after partial was removed")
+	}
+	if status := ts.Status()["t"]; status.Status != TemplateStatusInvalid || len(status.Error) == 0 {
+		t.Error("invalidated template not reported", status)
+	}
+
+	err = os.WriteFile(partial, []byte("{{.Columns | join \", \"}}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.handleFileEvent(dir, nil, fsnotify.Event{Name: partial, Op: fsnotify.Create})
+	persistence := newMemPersistence()
+	err = ts.UsePersistence(persistence, context.Background(), &sync.WaitGroup{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(persistence.partials["columns"]) == 0 {
+		t.Error("partial not stored", persistence.partials)
+	}
+	if _, ok := ts.Get("t"); !ok {
+		t.Error("template not loaded from persistence", ts.Status()["t"])
+	}
+
+	// partial and template added by another instance
+	persistence.templates["u"] = Template{Name: "u", CommandTemplate: "SELECT {{template \"other\" .}};", DeleteTemplate: "SELECT 2;", Version: 1}
+	persistence.notify("u")
+	if _, ok := ts.Get("u"); ok {
+		t.Error("template using missing partial loaded")
+	}
+	err = persistence.InsertPartialIfMissing(Partial{Name: "other", Template: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Partials()["other"] != "1" {
+		t.Error("partial of other instance not loaded", ts.Partials())
+	}
+	if _, ok := ts.Get("u"); !ok {
+		t.Error("template not validated again after partial was added", ts.Status()["u"])
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	min := float64(1)
+	requested := Template{Name: "t", Version: 0, Parameters: []Parameter{
+		{Name: "n", Type: ParameterTypeInteger, Default: float64(7), AllowedValues: []any{float64(7), float64(14)}, Min: &min},
+	}}
+	// as read from the persistence
+	stored := Template{Name: "t", Version: 3, Parameters: []Parameter{
+		{Name: "n", Type: ParameterTypeInteger, Default: json.Number("7"), AllowedValues: []any{int64(7), json.Number("14")}, Min: &min},
+	}}
+	if v := nextVersion(stored, true, requested); v != 3 {
+		t.Error("version of unchanged template incremented", v)
+	}
+	requested.Description = "changed"
+	if v := nextVersion(stored, true, requested); v != 4 {
+		t.Error("version of changed template not incremented", v)
+	}
+	requested.Version = 10
+	if v := nextVersion(stored, true, requested); v != 10 {
+		t.Error("requested version not kept", v)
+	}
+	if v := nextVersion(Template{}, false, Template{Name: "t"}); v != 1 {
+		t.Error("unexpected version of new template", v)
+	}
+}
+
+func TestCreateUpdate(t *testing.T) {
+	log.InitForTest()
+	for name, persistence := range map[string]Persistence{"memory": nil, "persistence": newMemPersistence()} {
+		t.Run(name, func(t *testing.T) {
+			ts := &TemplateStore{templates: map[string]Template{}, invalid: map[string]TemplateInfo{}, partials: map[string]string{}, persistence: persistence}
+			_, err := ts.Update(Template{Name: "a", CommandTemplate: "SELECT 1;"})
+			if !errors.Is(err, ErrTemplateNotFound) {
+				t.Error("expected ErrTemplateNotFound, got", err)
+			}
+			created, err := ts.Create(Template{Name: "a", CommandTemplate: "SELECT 1;"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.Version != 1 {
+				t.Error("unexpected version", created.Version)
+			}
+			_, err = ts.Create(Template{Name: "a", CommandTemplate: "SELECT 2;"})
+			if !errors.Is(err, ErrTemplateExists) {
+				t.Error("expected ErrTemplateExists, got", err)
+			}
+			updated, err := ts.Update(Template{Name: "a", CommandTemplate: "SELECT 2;"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated.Version != 2 {
+				t.Error("version not incremented", updated.Version)
+			}
+			if tmpl, _ := ts.Get("a"); tmpl.CommandTemplate != "SELECT 2;" {
+				t.Error("template not updated", tmpl)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2026 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package templates
+
+import (
+	"bytes"
+	"errors"
+)
+
+type TemplateStatus = string
+
+const TemplateStatusValid TemplateStatus = "valid"
+const TemplateStatusInvalid TemplateStatus = "invalid"
+
+// TemplateInfo is a template with the result of its validation. Invalid templates can not be used to create rules.
+type TemplateInfo struct {
+	Template
+	Status TemplateStatus `json:"status"`
+	Error  string         `json:"error,omitempty"`
+	File   string         `json:"file,omitempty"` // set if the template was loaded from the TemplateDir and could not be stored
+}
+
+// Validate checks that the command and delete template can be parsed and rendered for a sample table
+// and that the parameters are declared correctly.
+func (t Template) Validate() error {
+	err := t.ValidateParameters()
+	if err != nil {
+		return errors.New("invalid parameters: " + err.Error())
+	}
+	sample := sampleTableInfo(t)
+	err = testRender(t.CommandTemplate, sample)
+	if err != nil {
+		return errors.New("invalid command_template: " + err.Error())
+	}
+	err = testRender(t.DeleteTemplate, sample)
+	if err != nil {
+		return errors.New("invalid delete_template: " + err.Error())
+	}
+	return nil
+}
+
+func testRender(t string, sample map[string]any) error {
+	tmpl, err := newTemplate("missingkey=error").Parse(t)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(&bytes.Buffer{}, sample)
+}
+
+// sampleTableInfo mirrors the fields of model.TableInfo with values of a made-up device table.
+// Params contains the default of each parameter or a value of its type.
+func sampleTableInfo(t Template) map[string]any {
+	params := map[string]any{}
+	for _, p := range t.Parameters {
+		var value any
+		switch {
+		case p.Default != nil:
+			value = p.Default
+		case len(p.AllowedValues) > 0:
+			value = p.AllowedValues[0]
+		case p.Type == ParameterTypeString:
+			value = "sample"
+		case p.Type == ParameterTypeBoolean:
+			value = false
+		case p.Min != nil:
+			value = *p.Min
+		default:
+			value = float64(0)
+		}
+		params[p.Name], _ = p.convert(value)
+	}
+	return map[string]any{
+		"Table":          "device:7IUxe2sUT32dRXAZhzXczw_service:F_gsbPBvSb6xEz8lAWpguw",
+		"UserIds":        []string{"ec85317b-6b14-4f7d-9d45-70198735dccf"},
+		"Roles":          []string{"admin"},
+		"ShortUserId":    "7IUxe2sUT32dRXAZhzXczw",
+		"DeviceId":       "urn:infai:ses:device:ec85317b-6b14-4f7d-9d45-70198735dccf",
+		"ShortDeviceId":  "7IUxe2sUT32dRXAZhzXczw",
+		"ServiceId":      "urn:infai:ses:service:17f82c6c-f06f-49be-b113-3f25016a60bb",
+		"ShortServiceId": "F_gsbPBvSb6xEz8lAWpguw",
+		"ExportId":       "",
+		"ShortExportId":  "",
+		"Columns":        []string{"time", "value", "unit"},
+		"Timezone":       "UTC",
+		"Params":         params,
+	}
+}